@@ -1,15 +1,9 @@
 package main
 
 import (
-	"context"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"os/exec"
 	"path/filepath"
-	"runtime"
 	"strings"
-	"time"
 
 	"github.com/itchio/headway/united"
 	"github.com/pkg/errors"
@@ -32,90 +26,39 @@ func (a *App) DiagnoseAppData() error {
 		return errors.WithStack(err)
 	}
 
-	brothPackages, err := a.ListFiles(brothFolder)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-	a.Infof("broth packages: %s", brothPackages)
-
-	butlerFolder := filepath.Join(brothFolder, "butler")
-	err = a.EnsureFolder(butlerFolder)
-	if err != nil {
-		return errors.WithStack(err)
+	if a.config.Snapshot == "" {
+		freeSpace, err := diskFreeSpace(appDataFolder)
+		if err != nil {
+			a.Warnf("Could not determine free space: %s", err.Error())
+		} else {
+			a.Infof("Free space on the data folder's drive: <code>%s</code>", united.FormatBytes(freeSpace))
+			a.RecordValue("free space", united.FormatBytes(freeSpace))
+		}
 	}
 
-	butlerVersionsFolder := filepath.Join(butlerFolder, "versions")
-	butlerVersions, err := a.ListFiles(butlerVersionsFolder)
+	brothPackages, err := a.ListFiles(brothFolder)
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	a.Infof("butler versions: %s", butlerVersions)
+	a.Infof("broth packages: %s", brothPackages)
+	a.RecordValue("broth packages", plainText(brothPackages))
 
-	butlerChosenVersionPath := filepath.Join(butlerFolder, ".chosen-version")
-	butlerChosenVersionContents, err := ioutil.ReadFile(butlerChosenVersionPath)
+	butlerExecutable, err := a.DiagnoseBrothPackage(brothFolder, "butler")
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	butlerChosenVersion := string(butlerChosenVersionContents)
-	a.Infof("butler chosen version: <code>%s</code>", butlerChosenVersion)
-
-	butlerChosenFolder := filepath.Join(butlerVersionsFolder, butlerChosenVersion)
 
-	butlerInstallMarker := filepath.Join(butlerChosenFolder, ".installed")
-	butlerInstallMarkerContents, err := ioutil.ReadFile(butlerInstallMarker)
-	if err != nil {
-		return errors.WithStack(err)
+	if a.config.Snapshot != "" {
+		a.Debugf("Not running butler from a snapshot")
+		return nil
 	}
-	a.Infof("Install marker: <code>%s</code>", string(butlerInstallMarkerContents))
 
-	butlerChosenFiles, err := a.ListFiles(butlerChosenFolder)
+	butlerVersion, err := a.RetrieveVersion(butlerExecutable, "-V")
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	a.Infof("Installed files: %s", butlerChosenFiles)
-
-	butlerExecutable := filepath.Join(butlerChosenFolder, "butler")
-	if runtime.GOOS == "windows" {
-		butlerExecutable += ".exe"
-	}
-	a.Debugf("Verifying <code>%s</code>", butlerExecutable)
-
-	var timeout = 5 * time.Second
-
-	{
-		a.Debugf("Retrieving butler version...")
-		errs := make(chan error)
-		ctx, cancel := context.WithCancel(context.Background())
-		var butlerVersion string
-
-		retrieveButlerVersion := func() error {
-			out, err := exec.Command(butlerExecutable, "-V").CombinedOutput()
-			if err != nil {
-				return errors.WithStack(err)
-			}
-			butlerVersion = strings.TrimSpace(string(out))
-			return nil
-		}
-
-		go func() {
-			timer := time.After(timeout)
-			select {
-			case <-ctx.Done():
-			case <-timer:
-				errs <- errors.Errorf("Timed out after %s", timeout)
-			}
-		}()
-		go func() {
-			defer cancel()
-			errs <- retrieveButlerVersion()
-		}()
-
-		err := <-errs
-		if err != nil {
-			return errors.WithStack(err)
-		}
-		a.Infof("butler version: <code>%s</code>", butlerVersion)
-	}
+	a.Infof("butler version: <code>%s</code>", butlerVersion)
+	a.RecordValue("butler version", butlerVersion)
 
 	err = a.TestButlerd(appDataFolder, butlerExecutable)
 	if err != nil {
@@ -125,8 +68,17 @@ func (a *App) DiagnoseAppData() error {
 	return nil
 }
 
+// GetAppDataFolder returns the itch data folder, which can be overridden
+// from the config.
+func (a *App) GetAppDataFolder() (string, error) {
+	if a.config.AppDataFolder != "" {
+		return a.config.AppDataFolder, nil
+	}
+	return a.getPlatformAppDataFolder()
+}
+
 func (a *App) ListFiles(folder string) (string, error) {
-	items, err := ioutil.ReadDir(folder)
+	items, err := a.fs.ReadDir(folder)
 	if err != nil {
 		return "", errors.WithStack(err)
 	}
@@ -147,7 +99,7 @@ func (a *App) ListFiles(folder string) (string, error) {
 }
 
 func (a *App) EnsureFolder(folder string) error {
-	stats, err := os.Stat(folder)
+	stats, err := a.fs.Stat(folder)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -160,7 +112,7 @@ func (a *App) EnsureFolder(folder string) error {
 }
 
 func (a *App) EnsureFile(file string) error {
-	stats, err := os.Stat(file)
+	stats, err := a.fs.Stat(file)
 	if err != nil {
 		return errors.WithStack(err)
 	}
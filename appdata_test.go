@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestDiagnoseAppData(t *testing.T) {
+	appDataFolder := filepath.Join(string(filepath.Separator)+"fixture", "itch")
+	packageFolder := filepath.Join(appDataFolder, "broth", "butler")
+
+	tests := []struct {
+		name    string
+		setup   func(a *App, fs *MemFS, runner *FakeRunner, executable string)
+		wantErr string
+		want    string
+	}{
+		{
+			name: "missing broth folder",
+			setup: func(a *App, fs *MemFS, runner *FakeRunner, executable string) {
+				fs.AddError(filepath.Join(appDataFolder, "broth"), os.ErrNotExist)
+			},
+			wantErr: "broth",
+		},
+		{
+			name: "missing install marker",
+			setup: func(a *App, fs *MemFS, runner *FakeRunner, executable string) {
+				fs.AddError(filepath.Join(packageFolder, "versions", "15.20.0", ".installed"), os.ErrNotExist)
+			},
+			wantErr: ".installed",
+		},
+		{
+			name: "unreadable chosen version",
+			setup: func(a *App, fs *MemFS, runner *FakeRunner, executable string) {
+				fs.AddError(filepath.Join(packageFolder, ".chosen-version"), os.ErrPermission)
+			},
+			wantErr: "permission denied",
+		},
+		{
+			name: "nonzero exit",
+			setup: func(a *App, fs *MemFS, runner *FakeRunner, executable string) {
+				runner.Add(&FakeCommand{Err: errors.New("exit status 1")}, executable, "-V")
+			},
+			wantErr: "exit status 1",
+		},
+		{
+			name: "hang",
+			setup: func(a *App, fs *MemFS, runner *FakeRunner, executable string) {
+				a.config.Timeouts.Process = 50 * time.Millisecond
+				runner.Add(&FakeCommand{Hang: true}, executable, "-V")
+			},
+			wantErr: "Timed out",
+		},
+		{
+			// the daemon itself is covered by TestTestButlerd
+			name: "daemon exits",
+			setup: func(a *App, fs *MemFS, runner *FakeRunner, executable string) {
+				fs.AddFile(filepath.Join(appDataFolder, "db", "butler.db"), nil)
+				runner.Add(&FakeCommand{Stdout: "v15.20.0, built on Jan 1 2020\n"}, executable, "-V")
+				runner.Add(&FakeCommand{Err: errors.New("exit status 1")}, executable)
+			},
+			wantErr: "exited before listening",
+			want:    "butler version: <code>v15.20.0, built on Jan 1 2020</code>",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := NewMemFS()
+			executable := addBrothPackage(fs, appDataFolder, "butler", "15.20.0")
+			runner := NewFakeRunner()
+
+			a := newTestApp()
+			a.fs, a.runner = fs, runner
+			a.config.AppDataFolder = appDataFolder
+			test.setup(a, fs, runner, executable)
+
+			err := a.DiagnoseAppData()
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("expected an error containing %q, got %v", test.wantErr, err)
+			}
+			if test.want != "" {
+				assertEntry(t, a.report, "info", test.want)
+			}
+		})
+	}
+}
@@ -4,6 +4,6 @@ package main
 
 import "github.com/pkg/errors"
 
-func (a *App) GetAppDataFolder() (string, error) {
+func (a *App) getPlatformAppDataFolder() (string, error) {
 	return "", errors.Errorf("stub!")
 }
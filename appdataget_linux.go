@@ -7,7 +7,7 @@ import (
 	"path/filepath"
 )
 
-func (a *App) GetAppDataFolder() (string, error) {
+func (a *App) getPlatformAppDataFolder() (string, error) {
 	appName := "itch"
 
 	configPath := os.Getenv("XDG_CONFIG_HOME")
@@ -9,7 +9,7 @@ import (
 	"github.com/pkg/errors"
 )
 
-func (a *App) GetAppDataFolder() (string, error) {
+func (a *App) getPlatformAppDataFolder() (string, error) {
 	base, err := winox.GetFolderPath(winox.FolderTypeAppData)
 	if err != nil {
 		return "", errors.WithStack(err)
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DiagnoseBrothPackage verifies that the broth package `name` has a chosen
+// version, that it's marked as installed, and returns the path to its
+// executable.
+func (a *App) DiagnoseBrothPackage(brothFolder string, name string) (string, error) {
+	packageFolder := filepath.Join(brothFolder, name)
+	err := a.EnsureFolder(packageFolder)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	versionsFolder := filepath.Join(packageFolder, "versions")
+	versions, err := a.ListFiles(versionsFolder)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	a.Infof("%s versions: %s", name, versions)
+
+	chosenVersionPath := filepath.Join(packageFolder, ".chosen-version")
+	chosenVersionContents, err := a.fs.ReadFile(chosenVersionPath)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	chosenVersion := string(chosenVersionContents)
+	a.Infof("%s chosen version: <code>%s</code>", name, chosenVersion)
+
+	chosenFolder := filepath.Join(versionsFolder, chosenVersion)
+
+	installMarker := filepath.Join(chosenFolder, ".installed")
+	installMarkerContents, err := a.fs.ReadFile(installMarker)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	a.Infof("Install marker: <code>%s</code>", string(installMarkerContents))
+
+	chosenFiles, err := a.ListFiles(chosenFolder)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	a.Infof("Installed files: %s", chosenFiles)
+
+	executable := filepath.Join(chosenFolder, name)
+	if runtime.GOOS == "windows" {
+		executable += ".exe"
+	}
+	if a.config.Snapshot != "" {
+		// snapshots may come from another OS
+		if err := a.EnsureFile(executable + ".exe"); err == nil {
+			executable += ".exe"
+		}
+	}
+	a.Debugf("Verifying <code>%s</code>", executable)
+
+	err = a.EnsureFile(executable)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return executable, nil
+}
+
+// RetrieveVersion runs `executable` with the given arguments and returns
+// its trimmed output, giving up if it takes too long.
+func (a *App) RetrieveVersion(executable string, args ...string) (string, error) {
+	var timeout = a.config.Timeouts.Process
+
+	a.Debugf("Retrieving <code>%s</code> version...", filepath.Base(executable))
+	errs := make(chan error, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	var version string
+
+	retrieveVersion := func() error {
+		out, err := a.runner.Command(ctx, executable, args...).CombinedOutput()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		version = strings.TrimSpace(string(out))
+		return nil
+	}
+
+	go func() {
+		timer := time.After(timeout)
+		select {
+		case <-ctx.Done():
+		case <-timer:
+			errs <- errors.Errorf("Timed out after %s", timeout)
+		}
+	}()
+	go func() {
+		defer cancel()
+		errs <- retrieveVersion()
+	}()
+
+	err := <-errs
+	// kills the process if it timed out
+	cancel()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return version, nil
+}
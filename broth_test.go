@@ -0,0 +1,23 @@
+package main
+
+import (
+	"path/filepath"
+	"runtime"
+)
+
+// addBrothPackage sets up an installed broth package in fs, and returns
+// the path of its executable
+func addBrothPackage(fs *MemFS, appDataFolder string, name string, version string) string {
+	packageFolder := filepath.Join(appDataFolder, "broth", name)
+	fs.AddFile(filepath.Join(packageFolder, ".chosen-version"), []byte(version))
+
+	versionFolder := filepath.Join(packageFolder, "versions", version)
+	fs.AddFile(filepath.Join(versionFolder, ".installed"), []byte(version))
+
+	executable := filepath.Join(versionFolder, name)
+	if runtime.GOOS == "windows" {
+		executable += ".exe"
+	}
+	fs.AddFile(executable, []byte("MZ"))
+	return executable
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxBundledLog is how much of the end of each log file goes in a bundle
+const maxBundledLog = 2 * 1024 * 1024
+
+// WriteBundle writes a zip file containing the report in every format,
+// along with the itch app's logs (unless the user withheld them) and
+// the last few past reports.
+// If encryption is enabled, the zip file is encrypted.
+func (a *App) WriteBundle(w io.Writer) error {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for _, format := range []string{"json", "text", "html"} {
+		entry, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     "report." + bundleExtensions[format],
+			Method:   zip.Deflate,
+			Modified: time.Now(),
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		err = reportFormats[format](a.report, entry)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if !a.report.IsWithheld(CategoryLogs) {
+		err := a.bundleLogs(zw)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	err := a.bundleHistory(zw)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if !a.config.Encryption.Enabled {
+		_, err = w.Write(buf.Bytes())
+		return errors.WithStack(err)
+	}
+
+	publicKey, err := a.config.Encryption.PublicKey()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	sealed, err := EncryptBundle(buf.Bytes(), publicKey)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = w.Write(sealed)
+	return errors.WithStack(err)
+}
+
+var bundleExtensions = map[string]string{
+	"json": "json",
+	"text": "txt",
+	"html": "html",
+}
+
+// bundleLogs adds the end of every file in the itch logs folder
+func (a *App) bundleLogs(zw *zip.Writer) error {
+	appDataFolder, err := a.GetAppDataFolder()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	logsFolder := filepath.Join(appDataFolder, "logs")
+	files, err := a.fs.ReadDir(logsFolder)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.WithStack(err)
+	}
+
+	for _, file := range files {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+
+		contents, err := readTail(a.fs, filepath.Join(logsFolder, file.Name()), maxBundledLog)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		entry, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     "logs/" + file.Name(),
+			Method:   zip.Deflate,
+			Modified: file.ModTime(),
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		_, err = io.WriteString(entry, a.Redact(string(contents)))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// readTail returns at most the last maxSize bytes of a file
+func readTail(fsys FS, path string, maxSize int64) ([]byte, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	stats, err := f.Stat()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if stats.Size() > maxSize {
+		_, err = f.Seek(stats.Size()-maxSize, io.SeekStart)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	contents, err := ioutil.ReadAll(io.LimitReader(f, maxSize))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return contents, nil
+}
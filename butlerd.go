@@ -6,8 +6,8 @@ import (
 	"encoding/json"
 	"io"
 	"net"
-	"os/exec"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -20,16 +20,25 @@ func (a *App) TestButlerd(appDataFolder string, butlerExecutable string) error {
 		return errors.WithStack(err)
 	}
 
+	a.Debugf("Testing local connections...")
+	err = a.TestLoopback()
+	if err != nil {
+		a.Errorf("Local connections are blocked: <code>%s</code>", err.Error())
+		a.Errorf("The itch app talks to butler over a local connection: security software (antivirus, firewall) may need an exception for itch and butler")
+		a.Warnf("Skipping butler daemon test")
+		return nil
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	var addr string
 	var secret string
-	addrErrs := make(chan error)
+	addrErrs := make(chan error, 3)
 	addrCtx, addrCancel := context.WithCancel(ctx)
 	defer addrCancel()
 
-	cmd := exec.CommandContext(
+	cmd := a.runner.Command(
 		ctx,
 		butlerExecutable,
 		"--json",
@@ -40,8 +49,16 @@ func (a *App) TestButlerd(appDataFolder string, butlerExecutable string) error {
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	go a.relay(stdout, "butler stdout", func(line string) bool {
-		msg := make(map[string]interface{})
+	var relays sync.WaitGroup
+	relays.Add(2)
+	go a.relay(&relays, stdout, "butler stdout", func(line string) bool {
+		var msg struct {
+			Type   string `json:"type"`
+			Secret string `json:"secret"`
+			TCP    *struct {
+				Address string `json:"address"`
+			} `json:"tcp"`
+		}
 
 		err := json.Unmarshal([]byte(line), &msg)
 		if err != nil {
@@ -49,15 +66,16 @@ func (a *App) TestButlerd(appDataFolder string, butlerExecutable string) error {
 			return false
 		}
 
-		typ, ok := msg["type"]
-		if !ok {
-			return false
-		}
-
-		if typ.(string) == "butlerd/listen-notification" {
-			tcp := msg["tcp"].(map[string]interface{})
-			secret = msg["secret"].(string)
-			addr = tcp["address"].(string)
+		if msg.Type == "butlerd/listen-notification" {
+			if a.redactor != nil {
+				a.redactor.AddSecret(msg.Secret)
+			}
+			if msg.Secret == "" || msg.TCP == nil || msg.TCP.Address == "" {
+				addrErrs <- errors.Errorf("malformed listen notification: %s", line)
+				return true
+			}
+			secret = msg.Secret
+			addr = msg.TCP.Address
 			addrErrs <- nil
 			addrCancel()
 			return true
@@ -69,7 +87,7 @@ func (a *App) TestButlerd(appDataFolder string, butlerExecutable string) error {
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	go a.relay(stderr, "butler stderr", nil)
+	go a.relay(&relays, stderr, "butler stderr", nil)
 
 	a.Debugf("Starting butler daemon...")
 	err = cmd.Start()
@@ -77,9 +95,19 @@ func (a *App) TestButlerd(appDataFolder string, butlerExecutable string) error {
 		return errors.WithStack(err)
 	}
 
+	go func() {
+		// the pipes are closed once the process exits, and Wait must
+		// only be called after everything was read from them.
+		relays.Wait()
+		err := cmd.Wait()
+		if addrCtx.Err() == nil {
+			addrErrs <- errors.Errorf("butler daemon exited before listening (%v)", err)
+		}
+	}()
+
 	a.Debugf("Waiting for daemon address")
 	go func() {
-		timeout := 5 * time.Second
+		timeout := a.config.Timeouts.Process
 		timer := time.After(timeout)
 		select {
 		case <-timer:
@@ -128,7 +156,11 @@ func (a *App) TestButlerd(appDataFolder string, butlerExecutable string) error {
 	if err != nil {
 		return errors.WithStack(err)
 	}
+	defer conn.Close()
 	a.Debugf("Connected...")
+	// a daemon that accepts connections, but never answers, shouldn't
+	// hang the whole diagnosis
+	conn.SetDeadline(time.Now().Add(a.config.Timeouts.Process))
 
 	sendReq := func(req RPCRequest) error {
 		reqBytes, err := json.Marshal(req)
@@ -214,10 +246,9 @@ func (a *App) TestButlerd(appDataFolder string, butlerExecutable string) error {
 			return errors.WithStack(err)
 		}
 
-		a.Infof("Found %d profiles", len(profs.Profiles))
-		for _, p := range profs.Profiles {
-			a.Infof("- %s", p.User.DisplayName)
-		}
+		// who they belong to is up to the profiles check, which the user
+		// can leave out of the report
+		a.Infof("butlerd answered, and knows about %d profiles", len(profs.Profiles))
 
 		return nil
 	}
@@ -229,7 +260,9 @@ func (a *App) TestButlerd(appDataFolder string, butlerExecutable string) error {
 	return nil
 }
 
-func (a *App) relay(reader io.Reader, label string, processLine func(string) bool) {
+func (a *App) relay(wg *sync.WaitGroup, reader io.Reader, label string, processLine func(string) bool) {
+	defer wg.Done()
+
 	s := bufio.NewScanner(reader)
 	for s.Scan() {
 		line := s.Text()
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestTestButlerd(t *testing.T) {
+	appDataFolder := filepath.Join(string(filepath.Separator)+"fixture", "itch")
+	dbPath := filepath.Join(appDataFolder, "db", "butler.db")
+
+	tests := []struct {
+		name    string
+		setup   func(a *App, fs *MemFS, runner *FakeRunner, executable string)
+		wantErr string
+	}{
+		{
+			name:    "missing database",
+			setup:   func(a *App, fs *MemFS, runner *FakeRunner, executable string) {},
+			wantErr: "butler.db",
+		},
+		{
+			name: "nonzero exit",
+			setup: func(a *App, fs *MemFS, runner *FakeRunner, executable string) {
+				fs.AddFile(dbPath, nil)
+				runner.Add(&FakeCommand{Stderr: "database is locked\n", Err: errors.New("exit status 1")}, executable)
+			},
+			wantErr: "exited before listening (exit status 1)",
+		},
+		{
+			name: "hang",
+			setup: func(a *App, fs *MemFS, runner *FakeRunner, executable string) {
+				fs.AddFile(dbPath, nil)
+				a.config.Timeouts.Process = 50 * time.Millisecond
+				runner.Add(&FakeCommand{Stdout: "starting up\n", Hang: true}, executable)
+			},
+			wantErr: "Timed out",
+		},
+		{
+			name: "malformed notification",
+			setup: func(a *App, fs *MemFS, runner *FakeRunner, executable string) {
+				fs.AddFile(dbPath, nil)
+				runner.Add(&FakeCommand{Stdout: `{"type": "butlerd/listen-notification", "secret": "s3cr3t"}` + "\n", Hang: true}, executable)
+			},
+			wantErr: "malformed listen notification",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := NewMemFS()
+			executable := addBrothPackage(fs, appDataFolder, "butler", "15.20.0")
+			runner := NewFakeRunner()
+
+			a := newTestApp()
+			a.fs, a.runner = fs, runner
+			test.setup(a, fs, runner, executable)
+
+			err := a.TestButlerd(appDataFolder, executable)
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("expected an error containing %q, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+// buildFakeButler builds cmd/fake-butler into folder, and returns the path
+// of its executable
+func buildFakeButler(t *testing.T, folder string) string {
+	if testing.Short() {
+		t.Skip("not building fake-butler in short mode")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("the go tool is needed to build fake-butler")
+	}
+
+	executable := filepath.Join(folder, "butler")
+	if runtime.GOOS == "windows" {
+		executable += ".exe"
+	}
+	out, err := exec.Command(goTool, "build", "-o", executable, "./cmd/fake-butler").CombinedOutput()
+	if err != nil {
+		t.Fatalf("building fake-butler: %v\n%s", err, out)
+	}
+	return executable
+}
+
+func TestButlerdAgainstFakeButler(t *testing.T) {
+	folder, err := ioutil.TempDir("", "itch-diag-butlerd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	executable := buildFakeButler(t, folder)
+	appDataFolder := filepath.Join(folder, "itch")
+	err = os.MkdirAll(filepath.Join(appDataFolder, "db"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(appDataFolder, "db", "butler.db"), nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scriptPath := filepath.Join(folder, "script.json")
+	os.Setenv("FAKE_BUTLER_SCRIPT", scriptPath)
+	defer os.Unsetenv("FAKE_BUTLER_SCRIPT")
+
+	tests := []struct {
+		name    string
+		script  string
+		wantErr string
+	}{
+		{
+			// only delays Profile.List, its result comes from the defaults
+			name:   "healthy",
+			script: `{"listenDelay": "10ms", "methods": {"Profile.List": {"delay": "10ms"}}}`,
+		},
+		{
+			name:    "slow to listen",
+			script:  `{"listenDelay": "5s"}`,
+			wantErr: "Timed out",
+		},
+		{
+			name:    "slow to answer",
+			script:  `{"methods": {"Profile.List": {"delay": "5s"}}}`,
+			wantErr: "expected to read a line",
+		},
+		{
+			// not JSON, so it's relayed like any other output
+			name:    "malformed notification",
+			script:  `{"notification": "malformed"}`,
+			wantErr: "Timed out",
+		},
+		{
+			name:    "incomplete notification",
+			script:  `{"notification": "incomplete"}`,
+			wantErr: "malformed listen notification",
+		},
+		{
+			name:    "wrong secret",
+			script:  `{"wrongSecret": true}`,
+			wantErr: "Incorrect secret",
+		},
+		{
+			name:    "crash on start",
+			script:  `{"crashOnStart": true}`,
+			wantErr: "exited before listening (exit status 2)",
+		},
+		{
+			name:    "crash midway",
+			script:  `{"methods": {"Profile.List": {"crash": true}}}`,
+			wantErr: "expected to read a line",
+		},
+		{
+			name:    "malformed reply",
+			script:  `{"methods": {"Profile.List": {"malformed": true}}}`,
+			wantErr: "unexpected end of JSON input",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ioutil.WriteFile(scriptPath, []byte(test.script), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			a := newTestApp()
+			a.config.Timeouts.Process = time.Second
+			err = a.TestButlerd(appDataFolder, executable)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("%+v", err)
+				}
+				assertEntry(t, a.report, "info", "knows about 1 profiles")
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("expected an error containing %q, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"mime"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// CheckEndpointResult compares what an endpoint returned with what it
+// should have returned, to detect captive portals and anything else that
+// rewrites traffic.
+func (a *App) CheckEndpointResult(ep Endpoint, res *EndpointResult) {
+	var problems []string
+
+	if ep.ExpectedStatus != 0 && res.StatusCode != ep.ExpectedStatus {
+		problems = append(problems, fmt.Sprintf("got HTTP %d instead of HTTP %d", res.StatusCode, ep.ExpectedStatus))
+	}
+
+	originalHost := hostOf(ep.URL)
+	for _, hop := range res.Redirects {
+		host := hostOf(hop.To)
+		switch {
+		case host == originalHost:
+			// good
+		case sameSite(host, originalHost), isItchHost(originalHost) && isItchHost(host):
+			a.Debugf("<code>%s</code> redirects to <code>%s</code>", originalHost, html.EscapeString(host))
+		default:
+			problems = append(problems, fmt.Sprintf("was redirected to <code>%s</code>", html.EscapeString(host)))
+		}
+	}
+
+	if ep.ExpectedContentType != "" {
+		contentType := res.Header.Get("Content-Type")
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || mediaType != ep.ExpectedContentType {
+			problems = append(problems, fmt.Sprintf("got content type <code>%s</code> instead of <code>%s</code>", html.EscapeString(contentType), ep.ExpectedContentType))
+		}
+	}
+
+	if ep.ExpectedBody != "" {
+		body := bytes.TrimSpace(res.Body)
+		if string(body) != ep.ExpectedBody {
+			problems = append(problems, fmt.Sprintf("got unexpected body <pre>%s</pre>", html.EscapeString(excerpt(string(body), 300))))
+		}
+	}
+
+	if len(problems) == 0 {
+		return
+	}
+
+	for _, problem := range problems {
+		a.Errorf("<code>%s</code>: %s", ep.URL, problem)
+	}
+	a.Errorf("Something between you and itch.io is rewriting traffic!")
+	if looksLikeHTML(res) {
+		a.Errorf("The response looks like a web page: you may be behind a captive portal (hotel, school or public Wi-Fi login page). Try opening a website in your browser first.")
+	}
+}
+
+func hostOf(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// itchDomains are the domains itch.io serves its website, API and
+// downloads from.
+var itchDomains = []string{
+	"itch.io",
+	"itch.zone",
+	"itch.ovh",
+}
+
+func isItchHost(host string) bool {
+	for _, domain := range itchDomains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameSite returns true if both hosts belong to the same registrable
+// domain, like www.example.com and cdn.example.com. IP addresses and
+// single-label hosts like localhost are only the same site as themselves.
+func sameSite(a string, b string) bool {
+	if a == b {
+		return true
+	}
+	if net.ParseIP(a) != nil || net.ParseIP(b) != nil {
+		return false
+	}
+	aDomain, err := publicsuffix.EffectiveTLDPlusOne(a)
+	if err != nil {
+		return false
+	}
+	bDomain, err := publicsuffix.EffectiveTLDPlusOne(b)
+	if err != nil {
+		return false
+	}
+	return aDomain == bDomain
+}
+
+func looksLikeHTML(res *EndpointResult) bool {
+	if strings.Contains(res.Header.Get("Content-Type"), "html") {
+		return true
+	}
+	body := strings.ToLower(string(bytes.TrimSpace(res.Body)))
+	return strings.HasPrefix(body, "<!doctype html") || strings.HasPrefix(body, "<html")
+}
+
+func excerpt(s string, maxLength int) string {
+	if len(s) <= maxLength {
+		return s
+	}
+	return s[:maxLength] + "…"
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestCheckEndpointResult(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ping.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("pong\n"))
+	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<!DOCTYPE html><html><body>Please accept the terms of use</body></html>"))
+	})
+	mux.HandleFunc("/ping.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("pong"))
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/moved-again", http.StatusFound)
+	})
+	mux.HandleFunc("/moved-again", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ping.txt", http.StatusFound)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// the same server, under another name
+	u, _ := url.Parse(srv.URL)
+	portalURL := "http://localhost:" + u.Port() + "/login"
+	mux.HandleFunc("/hijacked", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, portalURL, http.StatusFound)
+	})
+
+	pong := func(path string) Endpoint {
+		return Endpoint{
+			URL:                 srv.URL + path,
+			ExpectedStatus:      200,
+			ExpectedBody:        "pong",
+			ExpectedContentType: "text/plain",
+		}
+	}
+
+	tests := []struct {
+		name     string
+		endpoint Endpoint
+		problems []string
+	}{
+		{"correct body", pong("/ping.txt"), nil},
+		{"login page", pong("/login"), []string{"got unexpected body", "captive portal"}},
+		{"wrong content type", pong("/ping.json"), []string{"got content type <code>application/json</code>"}},
+		{"redirects on the same host", pong("/moved"), nil},
+		{"redirect chain to another host", pong("/hijacked"), []string{"was redirected to <code>localhost</code>", "captive portal"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := newTestApp()
+			res, err := a.ProbeEndpoint(test.endpoint.URL, nil)
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			a.CheckEndpointResult(test.endpoint, res)
+
+			if len(test.problems) == 0 {
+				assertNoEntry(t, a.report, "error", "")
+				return
+			}
+			assertEntry(t, a.report, "error", "rewriting traffic")
+			for _, problem := range test.problems {
+				assertEntry(t, a.report, "error", problem)
+			}
+		})
+	}
+}
+
+func TestSameSite(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"www.example.com", "cdn.example.com", true},
+		{"example.co.uk", "downloads.example.co.uk", true},
+		{"example.com", "example.org", false},
+		{"foo.github.io", "bar.github.io", false},
+		{"127.0.0.1", "127.0.0.1", true},
+		{"127.0.0.1", "localhost", false},
+	}
+	for _, test := range tests {
+		if got := sameSite(test.a, test.b); got != test.want {
+			t.Errorf("sameSite(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestCheckEndpointResultRedirects(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		to       string
+		flagged  bool
+	}{
+		{"https://itch.io/static/ping.txt", "https://static.itch.io/ping.txt", false},
+		{"https://broth.itch.ovh", "https://itch.zone/broth", false},
+		{"https://downloads.example.com/ping", "https://cdn.example.com/ping", false},
+		{"https://itch.io/static/ping.txt", "https://portal.example.com/login", true},
+		{"https://downloads.example.com/ping", "https://itch.io", true},
+	}
+	for _, test := range tests {
+		a := newTestApp()
+		a.CheckEndpointResult(Endpoint{URL: test.endpoint}, &EndpointResult{
+			Header:    http.Header{},
+			Redirects: []RedirectHop{{From: test.endpoint, To: test.to, StatusCode: 302}},
+		})
+		flagged := findEntry(a.report, "error", "was redirected") != nil
+		if flagged != test.flagged {
+			t.Errorf("%s → %s: flagged = %v, want %v", test.endpoint, test.to, flagged, test.flagged)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/proxy"
+)
+
+// expectedRootCAs are (parts of) the names of public certificate
+// authorities itch.io's endpoints are expected to chain up to.
+var expectedRootCAs = []string{
+	"DigiCert",
+	"Let's Encrypt",
+	"ISRG",
+	"GlobalSign",
+	"Sectigo",
+	"COMODO",
+	"USERTrust",
+	"Amazon",
+	"Starfield",
+	"Google Trust Services",
+	"GTS Root",
+	"Baltimore",
+	"Go Daddy",
+	"Entrust",
+	"IdenTrust",
+}
+
+// knownInterceptors are (parts of) the names of products that are known
+// to intercept HTTPS traffic by issuing their own certificates.
+var knownInterceptors = []string{
+	"Avast",
+	"AVG",
+	"Kaspersky",
+	"ESET",
+	"Bitdefender",
+	"Norton",
+	"Sophos",
+	"Fortinet",
+	"FortiGate",
+	"Zscaler",
+	"Palo Alto",
+	"Blue Coat",
+	"Cisco Umbrella",
+	"NetFilter",
+	"Fiddler",
+	"Charles Proxy",
+	"mitmproxy",
+}
+
+func (a *App) LogCertificateChain(endpoint string, state *tls.ConnectionState) {
+	for i, cert := range state.PeerCertificates {
+		a.LogCertificate(i, cert)
+	}
+
+	var root *x509.Certificate
+	if len(state.VerifiedChains) > 0 {
+		chain := state.VerifiedChains[0]
+		root = chain[len(chain)-1]
+	} else if len(state.PeerCertificates) > 0 {
+		root = state.PeerCertificates[len(state.PeerCertificates)-1]
+	}
+	if root == nil {
+		a.Warnf("<code>%s</code>: no certificates presented", endpoint)
+		return
+	}
+
+	rootName := certificateName(root.Subject.Organization, root.Subject.CommonName)
+	if matchesAny(rootName, expectedRootCAs) {
+		a.Debugf("Chain terminates in public CA <code>%s</code>", html.EscapeString(rootName))
+		return
+	}
+
+	a.Errorf("<code>%s</code>: certificate chain terminates in <code>%s</code>, which is not a public CA we expect", endpoint, html.EscapeString(rootName))
+	a.LogInterceptionHint(state.PeerCertificates)
+}
+
+func (a *App) LogCertificate(index int, cert *x509.Certificate) {
+	fingerprint := sha256.Sum256(cert.Raw)
+	a.InfoGroup().
+		Item("#%d <code>%s</code>", index, html.EscapeString(certificateName(cert.Subject.Organization, cert.Subject.CommonName))).
+		Item("issued by <code>%s</code>", html.EscapeString(certificateName(cert.Issuer.Organization, cert.Issuer.CommonName))).
+		Item("valid %s to %s", cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339)).
+		Item("SHA-256 <code>%x</code>", fingerprint).
+		End()
+}
+
+func (a *App) LogInterceptionHint(certs []*x509.Certificate) {
+	for _, cert := range certs {
+		issuer := certificateName(cert.Issuer.Organization, cert.Issuer.CommonName)
+		for _, interceptor := range knownInterceptors {
+			if strings.Contains(strings.ToLower(issuer), strings.ToLower(interceptor)) {
+				a.Errorf("Certificates are issued by <code>%s</code>: HTTPS scanning in that product is intercepting traffic to itch.io", interceptor)
+				return
+			}
+		}
+	}
+	a.Errorf("Antivirus HTTPS scanning, or a middlebox on your network, might be intercepting traffic to itch.io")
+}
+
+// LogEndpointError reports why requesting an endpoint failed, going into
+// details for certificate verification errors. proxyURL is the proxy the
+// request went through, if any.
+func (a *App) LogEndpointError(level string, endpoint string, proxyURL *url.URL, err error) {
+	label := "direct"
+	if proxyURL != nil {
+		label = fmt.Sprintf("through proxy <code>%s</code>", displayProxy(proxyURL.String()))
+	}
+
+	tlsErr := findTLSError(err)
+	if tlsErr == nil {
+		a.Logf(level, "<code>%s</code> (%s): %+v", endpoint, label, err)
+		return
+	}
+
+	a.Logf(level, "<code>%s</code> (%s): TLS verification failed: <code>%s</code>", endpoint, label, html.EscapeString(tlsErr.Error()))
+
+	u, parseErr := url.Parse(endpoint)
+	if parseErr != nil {
+		return
+	}
+	certs, fetchErr := FetchPresentedChain(u, proxyURL, a.config.Timeouts.Connect)
+	if fetchErr != nil {
+		a.Warnf("Could not retrieve presented certificate chain: %+v", fetchErr)
+	} else {
+		a.Infof("Certificate chain presented for <code>%s</code>:", u.Host)
+		for i, cert := range certs {
+			a.LogCertificate(i, cert)
+		}
+	}
+
+	if isCertificateTimeError(tlsErr) {
+		a.Errorf("Certificates look expired or not yet valid, which usually means the system clock is wrong (local time is <code>%s</code>): see the clock check below", time.Now().Format(time.RFC1123))
+		return
+	}
+	if fetchErr == nil {
+		a.LogInterceptionHint(certs)
+	}
+}
+
+// isCertificateTimeError returns true if err is about a certificate being
+// used outside of its validity period.
+func isCertificateTimeError(err error) bool {
+	invalidErr, ok := err.(x509.CertificateInvalidError)
+	return ok && invalidErr.Reason == x509.Expired
+}
+
+// findTLSError looks for a certificate verification error in
+// err's chain of causes.
+func findTLSError(err error) error {
+	for err != nil {
+		switch err.(type) {
+		case x509.UnknownAuthorityError, x509.HostnameError, x509.CertificateInvalidError, x509.SystemRootsError:
+			return err
+		}
+
+		cause := errors.Cause(err)
+		if cause != err {
+			err = cause
+			continue
+		}
+		if unwrapper, ok := err.(interface{ Unwrap() error }); ok {
+			err = unwrapper.Unwrap()
+			continue
+		}
+		return nil
+	}
+	return nil
+}
+
+// FetchPresentedChain connects to u's host without verifying certificates,
+// so we can see who issued the certificates we're being presented. If
+// proxyURL is set, it connects through it, like the request that failed.
+func FetchPresentedChain(u *url.URL, proxyURL *url.URL, timeout time.Duration) ([]*x509.Certificate, error) {
+	host := u.Hostname()
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	conn, err := dialThrough(proxyURL, net.JoinHostPort(host, port), timeout)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: true,
+	})
+	err = tlsConn.Handshake()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return tlsConn.ConnectionState().PeerCertificates, nil
+}
+
+// dialThrough opens a TCP connection to address, tunneling through
+// proxyURL if it's set.
+func dialThrough(proxyURL *url.URL, address string, timeout time.Duration) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+	}
+	if proxyURL == nil {
+		conn, err := dialer.Dial("tcp", address)
+		return conn, errors.WithStack(err)
+	}
+
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		socksDialer, err := proxy.FromURL(proxyURL, dialer)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		conn, err := socksDialer.Dial("tcp", address)
+		return conn, errors.WithStack(err)
+	case "http", "https":
+		// tunnel with CONNECT, below
+	default:
+		return nil, errors.Errorf("unsupported proxy scheme <code>%s</code>", proxyURL.Scheme)
+	}
+
+	proxyAddress := proxyURL.Host
+	if proxyURL.Port() == "" {
+		defaultPort := "80"
+		if proxyURL.Scheme == "https" {
+			defaultPort = "443"
+		}
+		proxyAddress = net.JoinHostPort(proxyURL.Hostname(), defaultPort)
+	}
+
+	conn, err := dialer.Dial("tcp", proxyAddress)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if proxyURL.Scheme == "https" {
+		conn = tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+	}
+
+	err = conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		conn.Close()
+		return nil, errors.WithStack(err)
+	}
+
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	err = req.Write(conn)
+	if err != nil {
+		conn.Close()
+		return nil, errors.WithStack(err)
+	}
+
+	res, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, errors.WithStack(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, errors.Errorf("proxy refused to connect to <code>%s</code>: %s", address, res.Status)
+	}
+	return conn, nil
+}
+
+func certificateName(organization []string, commonName string) string {
+	if len(organization) == 0 {
+		return commonName
+	}
+	if commonName == "" {
+		return strings.Join(organization, ", ")
+	}
+	return fmt.Sprintf("%s (%s)", commonName, strings.Join(organization, ", "))
+}
+
+func matchesAny(s string, candidates []string) bool {
+	for _, candidate := range candidates {
+		if strings.Contains(strings.ToLower(s), strings.ToLower(candidate)) {
+			return true
+		}
+	}
+	return false
+}
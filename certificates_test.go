@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// newConnectProxy returns a proxy that only supports CONNECT, and counts
+// the tunnels it opened.
+func newConnectProxy(t *testing.T, tunnels *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "CONNECT" {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		atomic.AddInt32(tunnels, 1)
+
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("hijacking: %v", err)
+			upstream.Close()
+			return
+		}
+		go func() {
+			defer conn.Close()
+			defer upstream.Close()
+			go io.Copy(upstream, conn)
+			io.Copy(conn, upstream)
+		}()
+	}))
+}
+
+func TestFetchPresentedChain(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	timeout := DefaultConfig().Timeouts.Connect
+
+	certs, err := FetchPresentedChain(u, nil, timeout)
+	if err != nil {
+		t.Fatalf("direct: %+v", err)
+	}
+	if len(certs) == 0 || !bytes.Equal(certs[0].Raw, srv.Certificate().Raw) {
+		t.Errorf("direct: got %d certificates, not the server's", len(certs))
+	}
+
+	var tunnels int32
+	proxy := newConnectProxy(t, &tunnels)
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	certs, err = FetchPresentedChain(u, proxyURL, timeout)
+	if err != nil {
+		t.Fatalf("through proxy: %+v", err)
+	}
+	if len(certs) == 0 || !bytes.Equal(certs[0].Raw, srv.Certificate().Raw) {
+		t.Errorf("through proxy: got %d certificates, not the server's", len(certs))
+	}
+	if n := atomic.LoadInt32(&tunnels); n != 1 {
+		t.Errorf("expected the proxy to open 1 tunnel, got %d", n)
+	}
+
+	// a proxy that refuses CONNECT
+	refusing := httptest.NewServer(http.NotFoundHandler())
+	defer refusing.Close()
+	refusingURL, _ := url.Parse(refusing.URL)
+	_, err = FetchPresentedChain(u, refusingURL, timeout)
+	if err == nil {
+		t.Errorf("expected an error from a proxy refusing CONNECT")
+	}
+}
+
+func TestLogEndpointErrorSelfSigned(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	a := newTestApp()
+	_, err := a.newDiagClient(nil).Get(srv.URL)
+	if err == nil {
+		t.Fatalf("expected self-signed certificate to be rejected")
+	}
+	if findTLSError(err) == nil {
+		t.Fatalf("expected a TLS error, got %+v", err)
+	}
+
+	a.LogEndpointError("error", srv.URL, nil, err)
+	assertEntry(t, a.report, "error", "TLS verification failed")
+	assertEntry(t, a.report, "info", "Certificate chain presented")
+	// httptest's certificate is issued by "Acme Co"
+	assertEntry(t, a.report, "info", "Acme Co")
+	assertEntry(t, a.report, "error", "might be intercepting traffic")
+	assertNoEntry(t, a.report, "error", "system clock")
+}
+
+func TestLogEndpointErrorExpired(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	a := newTestApp()
+	err := errors.WithStack(x509.CertificateInvalidError{
+		Cert:   srv.Certificate(),
+		Reason: x509.Expired,
+	})
+
+	a.LogEndpointError("error", srv.URL, nil, err)
+	assertEntry(t, a.report, "error", "system clock is wrong")
+	assertNoEntry(t, a.report, "error", "intercepting")
+}
+
+func TestLogCertificateChain(t *testing.T) {
+	tests := []struct {
+		name         string
+		organization string
+		commonName   string
+		level        string
+		want         string
+	}{
+		{"public CA", "Let's Encrypt", "R3", "debug", "public CA <code>R3 (Let&#39;s Encrypt)</code>"},
+		{"interceptor", "Avast", "Avast Web/Mail Shield Root", "error", "<code>Avast Web/Mail Shield Root (Avast)</code>, which is not a public CA"},
+		{"markup", "", "<b>Corp</b> & co", "error", "<code>&lt;b&gt;Corp&lt;/b&gt; &amp; co</code>"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var organization []string
+			if test.organization != "" {
+				organization = []string{test.organization}
+			}
+			root := &x509.Certificate{
+				Subject: pkix.Name{Organization: organization, CommonName: test.commonName},
+				Issuer:  pkix.Name{Organization: organization, CommonName: test.commonName},
+			}
+
+			a := newTestApp()
+			a.LogCertificateChain("https://itch.io", &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{root},
+			})
+			assertEntry(t, a.report, test.level, test.want)
+		})
+	}
+}
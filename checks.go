@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Check is a single diagnostic that can be selected from the command line
+type Check struct {
+	ID    string
+	Label string
+	Run   func() error
+	// Category is the kind of data the check collects, see dataCategories
+	Category string
+	// OptIn checks only run if enabled in the config, or selected explicitly
+	OptIn bool
+	// Offline checks only read files, so they can run against a snapshot
+	Offline bool
+}
+
+// Checks returns every check itch-diag knows about, in the order they run.
+func (a *App) Checks() []Check {
+	var checks []Check
+	checks = append(checks, a.PlatformChecks()...)
+	checks = append(checks, []Check{
+		{ID: "proxy", Label: "Detecting proxy configuration", Run: a.DiagnoseProxy, Category: CategoryNetwork},
+		{ID: "hosts", Label: "Looking for hosts file tampering", Run: a.DiagnoseHosts, Category: CategoryNetwork},
+		{ID: "connectivity", Label: "Diagnosing internet connectivity", Run: a.DiagnoseConnectivity, Category: CategoryNetwork},
+		{ID: "ranges", Label: "Verifying HTTP range requests", Run: a.DiagnoseRanges, Category: CategoryNetwork, OptIn: !a.config.RangeTest.Enabled},
+		{ID: "download", Label: "Testing download throughput and integrity", Run: a.DiagnoseDownload, Category: CategoryNetwork, OptIn: !a.config.DownloadTest.Enabled},
+		{ID: "appdata", Label: "Diagnosing itch app dependencies", Run: a.DiagnoseAppData, Category: CategoryPaths, Offline: true},
+		{ID: "database", Label: "Inspecting the itch app database", Run: a.DiagnoseDatabase, Category: CategoryDatabase, Offline: true},
+		{ID: "receipts", Label: "Verifying install receipts", Run: a.DiagnoseReceipts, Category: CategoryPaths, Offline: true},
+		{ID: "profiles", Label: "Listing saved profiles", Run: a.DiagnoseProfiles, Category: CategoryProfiles, Offline: true},
+		{ID: "sessions", Label: "Checking saved itch.io sessions", Run: a.DiagnoseSessions, Category: CategoryProfiles, OptIn: !a.config.APIProbe.Enabled},
+		{ID: "itch-setup", Label: "Diagnosing itch-setup", Run: a.DiagnoseItchSetup, Category: CategorySystem, Offline: true},
+		{ID: "installs", Label: "Looking for itch installations", Run: a.DiagnoseInstallations, Category: CategoryPaths},
+		{ID: "install-folder", Label: "Diagnosing install folder", Run: a.DiagnoseConfiguredInstallFolder, Category: CategoryPaths, OptIn: a.config.InstallFolder == "", Offline: true},
+	}...)
+	return checks
+}
+
+// ValidateCheckIDs makes sure every check selected or skipped in the config
+// exists, so a typo doesn't quietly run nothing.
+func (a *App) ValidateCheckIDs() error {
+	var ids []string
+	for _, check := range a.Checks() {
+		ids = append(ids, check.ID)
+	}
+
+	for _, selection := range []struct {
+		flag string
+		ids  []string
+	}{
+		{"-checks", a.config.Checks},
+		{"-skip-checks", a.config.SkipChecks},
+	} {
+		for _, id := range selection.ids {
+			if !containsString(ids, id) {
+				return errors.Errorf("unknown check %q in %s (valid checks: %s)", id, selection.flag, strings.Join(ids, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// ShouldRun returns true if check is selected by the config
+func (c *Config) ShouldRun(check Check) bool {
+	if c.Snapshot != "" && !check.Offline {
+		return false
+	}
+
+	for _, id := range c.SkipChecks {
+		if id == check.ID {
+			return false
+		}
+	}
+
+	if len(c.Checks) == 0 {
+		return !check.OptIn
+	}
+	for _, id := range c.Checks {
+		if id == check.ID {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *App) RunCheck(check Check) {
+	a.report.BeginCheck(check)
+	a.Debugf("%s...", check.Label)
+
+	var errText string
+	err := runRecovering(check.Run)
+	if err != nil {
+		a.Warnf("While doing '%s': <pre>%+v</pre>", check.Label, err)
+		errText = a.Redact(err.Error())
+	}
+	a.report.EndCheck(errText)
+}
+
+// runRecovering turns a panic into an error, so one broken check doesn't
+// take the others down, in headless mode too.
+func runRecovering(run func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("panic: %v", r)
+		}
+	}()
+	return run()
+}
+
+// DiagnoseConfiguredInstallFolder diagnoses the install folder given
+// in the config.
+func (a *App) DiagnoseConfiguredInstallFolder() error {
+	return a.DiagnoseInstallFolder(a.config.InstallFolder)
+}
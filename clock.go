@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/tls"
+	"html"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// clockSkewThreshold is how far off the system clock can be before
+// TLS and itch.io sessions start failing in confusing ways.
+const clockSkewThreshold = 2 * time.Minute
+
+// CheckClockSkew compares the local clock with the Date headers
+// returned by endpoints.
+func (a *App) CheckClockSkew(results []*EndpointResult) {
+	now := time.Now()
+	zone, offset := now.Zone()
+	a.InfoGroup().
+		Item("Local time is <code>%s</code>", now.Format(time.RFC1123)).
+		Item("Time zone <code>%s</code>", zone).
+		Item("UTC offset <code>%s</code>", formatUTCOffset(offset)).
+		End()
+
+	var skews []time.Duration
+	for _, res := range results {
+		skew, err := clockSkewFromHeader(res.Header, res.ReceivedAt)
+		if err != nil {
+			a.Debugf("<code>%s</code>: %s", res.Endpoint, err.Error())
+			continue
+		}
+		skews = append(skews, skew)
+	}
+
+	if len(skews) == 0 {
+		// a skewed clock is a common reason for all endpoints failing,
+		// so try harder to find out
+		skew, err := a.FallbackClockSkew()
+		if err != nil {
+			a.Warnf("Could not check clock skew: %s", err.Error())
+			return
+		}
+		skews = append(skews, skew)
+	}
+
+	sort.Slice(skews, func(i, j int) bool { return skews[i] < skews[j] })
+	skew := skews[len(skews)/2]
+
+	direction := "ahead of"
+	absSkew := skew
+	if skew < 0 {
+		direction = "behind"
+		absSkew = -skew
+	}
+
+	if absSkew > clockSkewThreshold {
+		a.Errorf("System clock is %s %s itch.io's servers!", absSkew, direction)
+		a.Errorf("This breaks secure connections (certificates look expired or not yet valid) and makes itch.io sessions expire. Enable automatic time synchronization and double-check the time zone.")
+		return
+	}
+	a.Infof("System clock is %s %s itch.io's servers (within %s)", absSkew, direction, clockSkewThreshold)
+}
+
+// clockSkewFromHeader returns how far ahead of the server's Date header
+// the local clock was when a response was received.
+func clockSkewFromHeader(header http.Header, receivedAt time.Time) (time.Duration, error) {
+	dateHeader := header.Get("Date")
+	if dateHeader == "" {
+		return 0, errors.Errorf("no Date header")
+	}
+	serverTime, err := http.ParseTime(dateHeader)
+	if err != nil {
+		return 0, errors.Errorf("invalid Date header <code>%s</code>", html.EscapeString(dateHeader))
+	}
+	// Date headers only have second precision
+	return receivedAt.Truncate(time.Second).Sub(serverTime), nil
+}
+
+// FallbackClockSkew reads the time from the configured endpoints when
+// none of them could be reached normally: first with a HEAD request that
+// doesn't verify certificates (which fails when the clock is off), then
+// over plain HTTP. Nothing but the Date header is used.
+func (a *App) FallbackClockSkew() (time.Duration, error) {
+	var lastErr error = errors.Errorf("no endpoint returned a Date header")
+	for _, ep := range a.config.Endpoints {
+		candidates := []string{ep.URL}
+		if strings.HasPrefix(ep.URL, "https://") {
+			candidates = append(candidates, "http://"+strings.TrimPrefix(ep.URL, "https://"))
+		}
+
+		for _, candidate := range candidates {
+			skew, err := a.probeClockSkew(candidate)
+			if err != nil {
+				a.Debugf("Could not read the time from <code>%s</code>: %s", candidate, err.Error())
+				lastErr = err
+				continue
+			}
+			a.Debugf("Read the time from <code>%s</code>, without verifying certificates", candidate)
+			return skew, nil
+		}
+	}
+	return 0, lastErr
+}
+
+func (a *App) probeClockSkew(endpoint string) (time.Duration, error) {
+	proxyURL, err := EndpointProxy(endpoint)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	req, err := http.NewRequest("HEAD", endpoint, nil)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	client := a.newDiagClient(proxyURL)
+	transport := client.Transport.(*http.Transport)
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.InsecureSkipVerify = true
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	res.Body.Close()
+
+	return clockSkewFromHeader(res.Header, time.Now())
+}
+
+func formatUTCOffset(offset int) string {
+	return time.Unix(0, 0).In(time.FixedZone("", offset)).Format("-07:00")
+}
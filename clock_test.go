@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dateHandler answers with a Date header that's offset from the local clock
+func dateHandler(offset time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(offset).UTC().Format(http.TimeFormat))
+	})
+}
+
+func TestCheckClockSkewFallback(t *testing.T) {
+	// self-signed, so only the fallback can read its Date header
+	tlsServer := httptest.NewTLSServer(dateHandler(-time.Hour))
+	defer tlsServer.Close()
+
+	plainServer := httptest.NewServer(dateHandler(time.Hour))
+	defer plainServer.Close()
+
+	tests := []struct {
+		name     string
+		endpoint string
+		message  string
+	}{
+		{"insecure HEAD", tlsServer.URL, "ahead of itch.io's servers"},
+		{"plain HTTP", "https://" + strings.TrimPrefix(plainServer.URL, "http://"), "behind itch.io's servers"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := newTestApp()
+			a.config.Endpoints = []Endpoint{{URL: test.endpoint}}
+			a.CheckClockSkew(nil)
+			assertEntry(t, a.report, "error", test.message)
+		})
+	}
+
+	t.Run("unreachable", func(t *testing.T) {
+		a := newTestApp()
+		a.config.Endpoints = nil
+		a.CheckClockSkew(nil)
+		assertEntry(t, a.report, "warn", "Could not check clock skew")
+	})
+}
@@ -0,0 +1,326 @@
+// fake-butler is a scripted stand-in for butler, to exercise the butlerd
+// checks of itch-diag without a real butler. It understands `-V` and
+// `daemon`, and misbehaves as told by a JSON script, given with -script or
+// the FAKE_BUTLER_SCRIPT environment variable.
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Script describes how the fake daemon behaves
+type Script struct {
+	// Version is printed by `-V`
+	Version string `json:"version"`
+	// VersionDelay is how long `-V` takes
+	VersionDelay Duration `json:"versionDelay"`
+
+	// ListenDelay is how long before the listen notification is sent
+	ListenDelay Duration `json:"listenDelay"`
+	// Notification is "normal", "malformed" (not JSON), "incomplete"
+	// (missing the address) or "none"
+	Notification string `json:"notification"`
+	// WrongSecret announces a different secret than the one
+	// Meta.Authenticate expects
+	WrongSecret bool `json:"wrongSecret"`
+	// CrashOnStart exits right away, with an error on stderr
+	CrashOnStart bool `json:"crashOnStart"`
+
+	// Methods are replies to JSON-RPC methods, by name. A script's
+	// methods are merged field by field with the defaults, so that, say,
+	// Profile.List can be delayed without repeating its result.
+	Methods map[string]*MethodScript `json:"methods"`
+}
+
+// MethodScript is how the fake daemon answers a JSON-RPC method
+type MethodScript struct {
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+	// Delay is how long before replying
+	Delay Duration `json:"delay"`
+	// Malformed replies with something that isn't JSON
+	Malformed bool `json:"malformed"`
+	// Crash exits instead of replying
+	Crash bool `json:"crash"`
+}
+
+type RPCError struct {
+	Code    int64  `json:"code"`
+	Message string `json:"message"`
+}
+
+// Duration is a time.Duration that reads from JSON strings like "2s"
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	d.Duration, err = time.ParseDuration(s)
+	return errors.WithStack(err)
+}
+
+func defaultScript() *Script {
+	return &Script{
+		Version:      "v15.21.0, built on Jan 1 2020 @ 00:00:00 from fake-butler",
+		Notification: "normal",
+		Methods: map[string]*MethodScript{
+			"Profile.List": {
+				Result: json.RawMessage(`{"profiles":[{"id":1,"user":{"id":1,"username":"fake","displayName":"Fake User"},"lastConnected":"2020-01-01T00:00:00Z"}]}`),
+			},
+		},
+	}
+}
+
+func main() {
+	log.SetFlags(0)
+
+	scriptPath := flag.String("script", os.Getenv("FAKE_BUTLER_SCRIPT"), "JSON file describing how to behave")
+	printVersion := flag.Bool("V", false, "Print version and exit")
+	flag.Bool("json", false, "Ignored, output is always JSON")
+	flag.String("dbpath", "", "Ignored")
+	flag.Parse()
+
+	script := defaultScript()
+	if *scriptPath != "" {
+		err := loadScript(*scriptPath, script)
+		if err != nil {
+			log.Fatalf("%+v", err)
+		}
+	}
+
+	if *printVersion {
+		time.Sleep(script.VersionDelay.Duration)
+		fmt.Println(script.Version)
+		return
+	}
+
+	if flag.Arg(0) != "daemon" {
+		log.Fatalf("fake-butler only knows -V and daemon")
+	}
+
+	err := runDaemon(script)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+}
+
+func loadScript(path string, script *Script) error {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var overrides struct {
+		Methods map[string]json.RawMessage `json:"methods"`
+	}
+	err = json.Unmarshal(contents, &overrides)
+	if err != nil {
+		return errors.Wrapf(err, "parsing %s", path)
+	}
+
+	methods := script.Methods
+	script.Methods = nil
+	err = json.Unmarshal(contents, script)
+	if err != nil {
+		return errors.Wrapf(err, "parsing %s", path)
+	}
+	script.Methods = methods
+
+	for name, raw := range overrides.Methods {
+		method := &MethodScript{}
+		if defaults, ok := methods[name]; ok {
+			*method = *defaults
+		}
+		err = json.Unmarshal(raw, method)
+		if err != nil {
+			return errors.Wrapf(err, "parsing %s method %s", path, name)
+		}
+		methods[name] = method
+	}
+	return nil
+}
+
+func runDaemon(script *Script) error {
+	if script.CrashOnStart {
+		fmt.Fprintf(os.Stderr, "panic: fake-butler crashing on start, as scripted\n")
+		os.Exit(2)
+	}
+
+	secret := randomSecret()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer listener.Close()
+
+	sendJSON(map[string]interface{}{
+		"type":    "log",
+		"level":   "info",
+		"message": "fake-butler daemon starting",
+	})
+
+	time.Sleep(script.ListenDelay.Duration)
+
+	announcedSecret := secret
+	if script.WrongSecret {
+		announcedSecret = randomSecret()
+	}
+
+	switch script.Notification {
+	case "", "normal":
+		sendJSON(map[string]interface{}{
+			"type":   "butlerd/listen-notification",
+			"secret": announcedSecret,
+			"tcp": map[string]interface{}{
+				"address": listener.Addr().String(),
+			},
+		})
+	case "malformed":
+		fmt.Printf("{\"type\":\"butlerd/listen-notification\",\"tcp\":{\"address\":\"%s\"\n", listener.Addr().String())
+	case "incomplete":
+		sendJSON(map[string]interface{}{
+			"type":   "butlerd/listen-notification",
+			"secret": announcedSecret,
+		})
+	case "none":
+	default:
+		return errors.Errorf("unknown notification kind %q", script.Notification)
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		go serve(conn, script, secret)
+	}
+}
+
+type rpcRequest struct {
+	ID     *int64          `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type rpcReply struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+func serve(conn net.Conn, script *Script, secret string) {
+	defer conn.Close()
+
+	var mu sync.Mutex
+	reply := func(r rpcReply) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		r.JSONRPC = "2.0"
+		payload, err := json.Marshal(r)
+		if err != nil {
+			log.Printf("while encoding reply: %+v", err)
+			return
+		}
+		conn.Write(append(payload, '\n'))
+	}
+
+	authenticated := false
+	s := bufio.NewScanner(conn)
+	for s.Scan() {
+		var req rpcRequest
+		err := json.Unmarshal(s.Bytes(), &req)
+		if err != nil {
+			reply(rpcReply{Error: &RPCError{Code: -32700, Message: "Parse error"}})
+			continue
+		}
+
+		if req.Method == "Meta.Authenticate" {
+			var params struct {
+				Secret string `json:"secret"`
+			}
+			json.Unmarshal(req.Params, &params)
+			if params.Secret != secret {
+				reply(rpcReply{ID: req.ID, Error: &RPCError{Code: -32000, Message: "Incorrect secret"}})
+				continue
+			}
+			authenticated = true
+		} else if !authenticated {
+			reply(rpcReply{ID: req.ID, Error: &RPCError{Code: -32000, Message: "Must authenticate first"}})
+			continue
+		}
+
+		method, ok := script.Methods[req.Method]
+		if !ok {
+			if req.Method == "Meta.Authenticate" {
+				reply(rpcReply{ID: req.ID, Result: json.RawMessage(`{"ok":true}`)})
+				continue
+			}
+			reply(rpcReply{ID: req.ID, Error: &RPCError{Code: -32601, Message: "Method not found: " + req.Method}})
+			continue
+		}
+
+		time.Sleep(method.Delay.Duration)
+		switch {
+		case method.Crash:
+			fmt.Fprintf(os.Stderr, "panic: fake-butler crashing on %s, as scripted\n", req.Method)
+			os.Exit(2)
+		case method.Malformed:
+			mu.Lock()
+			fmt.Fprintf(conn, "{\"jsonrpc\":\"2.0\",\"id\":%d,\"result\":{\n", derefID(req.ID))
+			mu.Unlock()
+		case method.Error != nil:
+			reply(rpcReply{ID: req.ID, Error: method.Error})
+		default:
+			result := method.Result
+			if len(result) == 0 {
+				result = json.RawMessage(`{}`)
+			}
+			reply(rpcReply{ID: req.ID, Result: result})
+		}
+	}
+}
+
+func derefID(id *int64) int64 {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
+
+func sendJSON(v interface{}) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+	fmt.Println(string(payload))
+}
+
+func randomSecret() string {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+	return hex.EncodeToString(buf)
+}
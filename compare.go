@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CheckDiff is what changed in a check between two reports
+type CheckDiff struct {
+	ID     string
+	Label  string
+	Before *CheckResult
+	After  *CheckResult
+	Values []ValueDiff
+	// UnchangedValues is how many values are the same in both reports
+	UnchangedValues int
+}
+
+// ValueDiff is a value that changed between two reports. Before or After
+// is empty if the value is only in one of them.
+type ValueDiff struct {
+	Key    string
+	Before string
+	After  string
+	// WithinTolerance is set for measurements that changed about as much
+	// as they do between any two runs, see withinTolerance
+	WithinTolerance bool
+}
+
+// Changed returns true if anything worth showing changed
+func (cd *CheckDiff) Changed() bool {
+	if cd.Before == nil || cd.After == nil {
+		return true
+	}
+	if cd.Before.Status != cd.After.Status {
+		return true
+	}
+	for _, vd := range cd.Values {
+		if !vd.WithinTolerance {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// latencies under this are mostly jitter
+	latencyTolerance = 250 * time.Millisecond
+	// free space changes with every download and update
+	freeSpaceTolerance = 0.1
+)
+
+// withinTolerance returns true if a measurement changed too little to
+// matter: latencies by less than latencyTolerance (or half of what they
+// were), free space by less than freeSpaceTolerance.
+func withinTolerance(key string, before string, after string) bool {
+	switch {
+	case strings.Contains(key, " latency ("):
+		beforeDuration, beforeErr := time.ParseDuration(before)
+		afterDuration, afterErr := time.ParseDuration(after)
+		if beforeErr != nil || afterErr != nil {
+			return false
+		}
+		delta := afterDuration - beforeDuration
+		if delta < 0 {
+			delta = -delta
+		}
+		return delta < latencyTolerance || delta < beforeDuration/2
+	case key == "free space":
+		beforeBytes, beforeErr := parseFormattedBytes(before)
+		afterBytes, afterErr := parseFormattedBytes(after)
+		if beforeErr != nil || afterErr != nil || beforeBytes == 0 {
+			return false
+		}
+		return math.Abs(afterBytes-beforeBytes)/beforeBytes < freeSpaceTolerance
+	}
+	return false
+}
+
+var byteUnits = map[string]float64{
+	"B":   1,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+}
+
+// parseFormattedBytes reads sizes formatted by united.FormatBytes, like
+// "12.34 GiB"
+func parseFormattedBytes(s string) (float64, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return 0, errors.Errorf("not a size: %q", s)
+	}
+	unit, ok := byteUnits[fields[1]]
+	if !ok {
+		return 0, errors.Errorf("unknown unit in %q", s)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return value * unit, nil
+}
+
+// CompareReports lists checks of both reports, in the order they ran
+func CompareReports(before *Report, after *Report) []*CheckDiff {
+	var diffs []*CheckDiff
+	byID := make(map[string]*CheckDiff)
+	add := func(check *CheckResult) *CheckDiff {
+		diff, ok := byID[check.ID]
+		if !ok {
+			diff = &CheckDiff{ID: check.ID, Label: check.Label}
+			byID[check.ID] = diff
+			diffs = append(diffs, diff)
+		}
+		return diff
+	}
+	for _, check := range before.Checks {
+		add(check).Before = check
+	}
+	for _, check := range after.Checks {
+		add(check).After = check
+	}
+
+	for _, diff := range diffs {
+		var beforeValues, afterValues map[string]string
+		if diff.Before != nil {
+			beforeValues = diff.Before.Values
+		}
+		if diff.After != nil {
+			afterValues = diff.After.Values
+		}
+
+		keys := make(map[string]bool)
+		for key := range beforeValues {
+			keys[key] = true
+		}
+		for key := range afterValues {
+			keys[key] = true
+		}
+		var sortedKeys []string
+		for key := range keys {
+			sortedKeys = append(sortedKeys, key)
+		}
+		sort.Strings(sortedKeys)
+
+		for _, key := range sortedKeys {
+			beforeValue, afterValue := beforeValues[key], afterValues[key]
+			if beforeValue == afterValue {
+				diff.UnchangedValues++
+				continue
+			}
+			diff.Values = append(diff.Values, ValueDiff{
+				Key:             key,
+				Before:          beforeValue,
+				After:           afterValue,
+				WithinTolerance: withinTolerance(key, beforeValue, afterValue),
+			})
+		}
+	}
+	return diffs
+}
+
+// statusRanks orders statuses from best to worst
+var statusRanks = map[string]int{
+	StatusOK:    0,
+	StatusWarn:  1,
+	StatusError: 2,
+}
+
+func describeStatusChange(before string, after string) string {
+	if before == after {
+		return after
+	}
+
+	change := fmt.Sprintf("%s → %s", before, after)
+	beforeRank, beforeRanked := statusRanks[before]
+	afterRank, afterRanked := statusRanks[after]
+	if beforeRanked && afterRanked {
+		if afterRank < beforeRank {
+			change += " (better)"
+		} else {
+			change += " (worse)"
+		}
+	}
+	return change
+}
+
+func describeValueChange(vd ValueDiff) string {
+	switch {
+	case vd.Before == "":
+		return fmt.Sprintf("%s: added %q", vd.Key, vd.After)
+	case vd.After == "":
+		return fmt.Sprintf("%s: removed (was %q)", vd.Key, vd.Before)
+	}
+
+	change := fmt.Sprintf("%s: %q → %q", vd.Key, vd.Before, vd.After)
+	// show how much durations (like latencies) changed
+	beforeDuration, beforeErr := time.ParseDuration(vd.Before)
+	afterDuration, afterErr := time.ParseDuration(vd.After)
+	if beforeErr == nil && afterErr == nil && beforeDuration > 0 {
+		percent := float64(afterDuration-beforeDuration) / float64(beforeDuration) * 100
+		change += fmt.Sprintf(" (%+.0f%%)", percent)
+	}
+	return change
+}
+
+// WriteComparison describes what changed between two reports. Unchanged
+// checks and values, and measurements within tolerance, are collapsed,
+// unless showAll is set.
+func WriteComparison(w io.Writer, before *Report, after *Report, showAll bool) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Before: itch-diag v%s (%s/%s), %s\n", before.Version, before.OS, before.Arch, before.StartedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "After:  itch-diag v%s (%s/%s), %s\n", after.Version, after.OS, after.Arch, after.StartedAt.Format(time.RFC3339))
+
+	var unchanged []string
+	for _, diff := range CompareReports(before, after) {
+		if !diff.Changed() && !showAll {
+			unchanged = append(unchanged, diff.ID)
+			continue
+		}
+
+		switch {
+		case diff.Before == nil:
+			fmt.Fprintf(&b, "\n== %s (%s): only in after, %s\n", diff.Label, diff.ID, diff.After.Status)
+		case diff.After == nil:
+			fmt.Fprintf(&b, "\n== %s (%s): only in before, %s\n", diff.Label, diff.ID, diff.Before.Status)
+		default:
+			fmt.Fprintf(&b, "\n== %s (%s): %s\n", diff.Label, diff.ID, describeStatusChange(diff.Before.Status, diff.After.Status))
+		}
+
+		var tolerated int
+		for _, vd := range diff.Values {
+			if vd.WithinTolerance && !showAll {
+				tolerated++
+				continue
+			}
+			fmt.Fprintf(&b, "  %s\n", describeValueChange(vd))
+		}
+		if diff.UnchangedValues > 0 {
+			fmt.Fprintf(&b, "  (%d unchanged values)\n", diff.UnchangedValues)
+		}
+		if tolerated > 0 {
+			fmt.Fprintf(&b, "  (%d measurements within tolerance)\n", tolerated)
+		}
+		if diff.After != nil && diff.After.Error != "" && (diff.Before == nil || diff.Before.Error != diff.After.Error) {
+			fmt.Fprintf(&b, "  error: %s\n", firstLine(diff.After.Error))
+		}
+	}
+
+	if len(unchanged) > 0 {
+		fmt.Fprintf(&b, "\n%d unchanged checks: %s\n", len(unchanged), strings.Join(unchanged, ", "))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return errors.WithStack(err)
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// LoadReport reads a report written with `-output json:path`
+func LoadReport(path string) (*Report, error) {
+	return readReport(osFS{}, path)
+}
+
+func readReport(fsys FS, path string) (*Report, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	var report Report
+	err = json.NewDecoder(f).Decode(&report)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", path)
+	}
+	return &report, nil
+}
+
+// RunCompare shows what changed between two JSON reports
+func RunCompare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	showAll := fs.Bool("all", false, "Also show checks that didn't change, and small changes in latency and free space")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: itch-diag compare [options] before.json after.json\n")
+		fs.PrintDefaults()
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	before, err := LoadReport(fs.Arg(0))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	after, err := LoadReport(fs.Arg(1))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return WriteComparison(os.Stdout, before, after, *showAll)
+}
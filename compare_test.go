@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWithinTolerance(t *testing.T) {
+	tests := []struct {
+		key    string
+		before string
+		after  string
+		want   bool
+	}{
+		{"https://itch.io latency (direct)", "120ms", "180ms", true},
+		{"https://itch.io latency (direct)", "2s", "2.9s", true},
+		{"https://itch.io latency (direct)", "150ms", "1.2s", false},
+		{"https://itch.io latency (direct)", "150ms", "timeout", false},
+		{"free space", "120.50 GiB", "118.20 GiB", true},
+		{"free space", "120.50 GiB", "900.00 MiB", false},
+		{"butler version", "v15.20.0", "v15.21.0", false},
+		{"broth packages", "butler/", "butler/, itch-setup/", false},
+	}
+
+	for _, test := range tests {
+		if got := withinTolerance(test.key, test.before, test.after); got != test.want {
+			t.Errorf("withinTolerance(%q, %q, %q) = %v, want %v", test.key, test.before, test.after, got, test.want)
+		}
+	}
+}
+
+func TestWriteComparison(t *testing.T) {
+	before := NewReport()
+	before.Checks = []*CheckResult{
+		{ID: "appdata", Label: "Diagnosing app data", Status: StatusOK, Values: map[string]string{
+			"free space":     "120.50 GiB",
+			"butler version": "v15.20.0",
+		}},
+		{ID: "connectivity", Label: "Diagnosing internet connectivity", Status: StatusOK, Values: map[string]string{
+			"https://itch.io latency (direct)": "120ms",
+		}},
+	}
+	after := NewReport()
+	after.Checks = []*CheckResult{
+		{ID: "appdata", Label: "Diagnosing app data", Status: StatusOK, Values: map[string]string{
+			"free space":     "119.80 GiB",
+			"butler version": "v15.21.0",
+		}},
+		{ID: "connectivity", Label: "Diagnosing internet connectivity", Status: StatusOK, Values: map[string]string{
+			"https://itch.io latency (direct)": "140ms",
+		}},
+	}
+
+	var b strings.Builder
+	err := WriteComparison(&b, before, after, false)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		`butler version: "v15.20.0" → "v15.21.0"`,
+		"(1 measurements within tolerance)",
+		"1 unchanged checks: connectivity",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "free space:") || strings.Contains(out, "latency (direct):") {
+		t.Errorf("measurements within tolerance should be collapsed:\n%s", out)
+	}
+
+	b.Reset()
+	err = WriteComparison(&b, before, after, true)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	out = b.String()
+	for _, want := range []string{
+		`free space: "120.50 GiB" → "119.80 GiB"`,
+		`https://itch.io latency (direct): "120ms" → "140ms" (+17%)`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("with -all, expected %q in:\n%s", want, out)
+		}
+	}
+}
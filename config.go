@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Config holds the settings of a diagnostic run. They can be set from
+// a JSON config file, whose keys are flag names, and from command-line
+// flags, which take precedence.
+type Config struct {
+	// ConfigFile is the JSON file settings were loaded from, if any
+	ConfigFile string
+
+	// Checks, if not empty, is the list of checks to run
+	Checks []string
+	// SkipChecks is a list of checks not to run
+	SkipChecks []string
+
+	// AppDataFolder overrides the itch data folder (containing broth, db, etc.)
+	AppDataFolder string
+	// InstallFolder overrides the itch install folder (containing state.json)
+	InstallFolder string
+	// Snapshot is a copy of someone's itch data folder to analyze instead
+	// of ours. Only checks that don't run anything or use the network run.
+	Snapshot string
+
+	Timeouts TimeoutsConfig
+
+	// Outputs are where reports are written, as `format:path`
+	Outputs []string
+	// Headless runs without a window, logging to stderr
+	Headless bool
+	Window   WindowConfig
+
+	// UserAgent logs the webview's User-Agent
+	UserAgent bool
+	// Redact scrubs personal information and secrets from everything logged
+	Redact bool
+	// History keeps past reports in the itch data folder, to point out
+	// what changed since previous runs
+	History bool
+	// Consent lists the data categories allowed in reports (default: all).
+	// In windowed mode, the user confirms them before anything is saved.
+	Consent []string
+
+	// Endpoints is the catalog of URLs probed by the connectivity check
+	Endpoints []Endpoint
+
+	// EndpointsFile, if set, replaces Endpoints with the contents of a file
+	EndpointsFile string
+	// FlagEndpoints, if any, replace Endpoints
+	FlagEndpoints []Endpoint
+
+	DownloadTest DownloadTestConfig
+	RangeTest    RangeTestConfig
+	Monitor      MonitorConfig
+	APIProbe     APIProbeConfig
+	Support      SupportConfig
+	Encryption   EncryptionConfig
+}
+
+// TimeoutsConfig holds how long we're willing to wait for various things
+type TimeoutsConfig struct {
+	// Process is for running butler, itch-setup, etc.
+	Process time.Duration
+	// Connect is for establishing a single connection
+	Connect time.Duration
+	// HTTP is for a whole HTTP request (except the download test)
+	HTTP time.Duration
+}
+
+// WindowConfig holds the size of the diagnostics window
+type WindowConfig struct {
+	Width  int
+	Height int
+}
+
+// DownloadTestConfig controls the (opt-in) bandwidth and integrity check
+type DownloadTestConfig struct {
+	Enabled bool
+	URL     string
+	// SHA256 is the expected hash of the download. If it's empty and the
+	// download is a zip archive, the files it contains are checked instead.
+	SHA256 string
+}
+
+// RangeTestConfig controls the HTTP range requests check
+type RangeTestConfig struct {
+	Enabled bool
+	URL     string
+}
+
+// defaultDownloadTestURL points to a butler archive, which is a large enough
+// object served by the itch CDN.
+const defaultDownloadTestURL = "https://broth.itch.ovh/butler/windows-amd64/15.21.0/archive/default"
+
+func DefaultConfig() *Config {
+	return &Config{
+		Timeouts: TimeoutsConfig{
+			Process: 5 * time.Second,
+			Connect: 5 * time.Second,
+			HTTP:    60 * time.Second,
+		},
+		Window: WindowConfig{
+			Width:  1100,
+			Height: 800,
+		},
+		Redact:    true,
+		History:   true,
+		Endpoints: DefaultEndpoints(),
+		DownloadTest: DownloadTestConfig{
+			URL: defaultDownloadTestURL,
+		},
+		RangeTest: RangeTestConfig{
+			Enabled: true,
+			URL:     defaultDownloadTestURL,
+		},
+		Monitor: MonitorConfig{
+			Interval: 10 * time.Second,
+		},
+		APIProbe: APIProbeConfig{
+			BaseURL: defaultAPIBaseURL,
+		},
+		Support: SupportConfig{
+			Retries: 3,
+		},
+	}
+}
+
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.ConfigFile, "config", c.ConfigFile, "JSON file to load settings from (keys are flag names)")
+
+	fs.Var(&stringListFlag{&c.Checks}, "checks", "Comma-separated list of checks to run (default: all)")
+	fs.Var(&stringListFlag{&c.SkipChecks}, "skip-checks", "Comma-separated list of checks not to run")
+	fs.StringVar(&c.AppDataFolder, "appdata", c.AppDataFolder, "Path of the itch data folder (default: auto-detected)")
+	fs.StringVar(&c.InstallFolder, "install-folder", c.InstallFolder, "Path of the itch install folder (default: auto-detected)")
+	fs.StringVar(&c.Snapshot, "snapshot", c.Snapshot, "Analyze a copy of an itch data folder instead, without running anything or using the network")
+
+	fs.DurationVar(&c.Timeouts.Process, "timeout-process", c.Timeouts.Process, "How long to wait for butler, itch-setup, etc.")
+	fs.DurationVar(&c.Timeouts.Connect, "timeout-connect", c.Timeouts.Connect, "How long to wait for a connection to be established")
+	fs.DurationVar(&c.Timeouts.HTTP, "timeout-http", c.Timeouts.HTTP, "How long to wait for an HTTP request to complete")
+
+	fs.Var(&stringListFlag{&c.Outputs}, "output", "Write a report, as `format:path` where format is json, text, html or bundle (a zip file with the report and itch logs), and path can be - for stdout (can be repeated)")
+	fs.BoolVar(&c.Encryption.Enabled, "encrypt", c.Encryption.Enabled, "Encrypt bundles so that only itch support can open them")
+	fs.StringVar(&c.Encryption.Key, "encrypt-key", c.Encryption.Key, "Public key to encrypt bundles to, base64-encoded (default: the one built in)")
+	fs.BoolVar(&c.Headless, "headless", c.Headless, "Run without a window")
+	fs.IntVar(&c.Window.Width, "width", c.Window.Width, "Width of the window")
+	fs.IntVar(&c.Window.Height, "height", c.Window.Height, "Height of the window")
+	fs.BoolVar(&c.UserAgent, "user-agent", c.UserAgent, "Log the User-Agent of the window")
+	fs.Var(&stringListFlag{&c.Consent}, "consent", "Comma-separated list of data categories allowed in reports: system, paths, profiles, logs, database, network (default: all)")
+	fs.BoolVar(&c.History, "history", c.History, "Keep past reports in the itch data folder, and point out what changed since")
+	fs.BoolVar(&c.Redact, "redact", c.Redact, "Redact personal information (paths, usernames, display names) and secrets")
+
+	fs.StringVar(&c.EndpointsFile, "endpoints", c.EndpointsFile, "JSON file with the list of endpoints to probe")
+	fs.Var(&endpointsFlag{&c.FlagEndpoints}, "endpoint", "Endpoint to probe, as `[purpose=]URL` (can be repeated)")
+	fs.BoolVar(&c.DownloadTest.Enabled, "download-test", c.DownloadTest.Enabled, "Download a large test object to measure throughput and check integrity")
+	fs.StringVar(&c.DownloadTest.URL, "download-url", c.DownloadTest.URL, "URL of the download test object")
+	fs.StringVar(&c.DownloadTest.SHA256, "download-sha256", c.DownloadTest.SHA256, "Expected SHA-256 of the download test object (hex)")
+	fs.BoolVar(&c.RangeTest.Enabled, "range-test", c.RangeTest.Enabled, "Check that HTTP range requests work")
+	fs.StringVar(&c.RangeTest.URL, "range-url", c.RangeTest.URL, "URL of the object used to check HTTP range requests")
+	fs.DurationVar(&c.Monitor.Duration, "monitor", c.Monitor.Duration, "Monitor connectivity for this long (e.g. 10m) instead of running diagnostics")
+	fs.DurationVar(&c.Monitor.Interval, "monitor-interval", c.Monitor.Interval, "Time between two monitoring rounds")
+	fs.BoolVar(&c.APIProbe.Enabled, "api-probe", c.APIProbe.Enabled, "Check saved itch.io sessions with an authenticated API call")
+	fs.StringVar(&c.APIProbe.BaseURL, "api-base", c.APIProbe.BaseURL, "Base URL of the itch.io API")
+	fs.StringVar(&c.Support.URL, "support-url", c.Support.URL, "HTTPS endpoint reports are sent to with \"Send to itch support\"")
+	fs.BoolVar(&c.Support.Send, "send", c.Support.Send, "Send the report to itch support when done")
+	fs.IntVar(&c.Support.Retries, "support-retries", c.Support.Retries, "How many times to retry a failed upload")
+}
+
+// Parse loads settings from the config file (if one is given in args),
+// then from args themselves.
+func (c *Config) Parse(fs *flag.FlagSet, args []string) error {
+	configFile := findFlagValue(args, "config")
+	if configFile != "" {
+		err := LoadConfigFile(fs, configFile)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return c.finish()
+}
+
+// LoadConfigFile sets flags from a JSON object whose keys are flag names.
+// Arrays set repeatable flags once per item.
+func LoadConfigFile(fs *flag.FlagSet, path string) error {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var settings map[string]interface{}
+	err = json.Unmarshal(contents, &settings)
+	if err != nil {
+		return errors.Wrapf(err, "while decoding %s", path)
+	}
+
+	for name, value := range settings {
+		if name == "config" || fs.Lookup(name) == nil {
+			return errors.Errorf("%s: unknown setting %q", path, name)
+		}
+
+		values := []interface{}{value}
+		if list, ok := value.([]interface{}); ok {
+			values = list
+		}
+		for _, v := range values {
+			err = fs.Set(name, fmt.Sprint(v))
+			if err != nil {
+				return errors.Wrapf(err, "%s: invalid value for %q", path, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// findFlagValue looks for `-name value`, `-name=value` and their
+// double-dash variants in args.
+func findFlagValue(args []string, name string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		trimmed := strings.TrimLeft(arg, "-")
+		if trimmed == arg {
+			continue
+		}
+		if trimmed == name && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(trimmed, name+"=") {
+			return strings.TrimPrefix(trimmed, name+"=")
+		}
+	}
+	return ""
+}
+
+// finish applies settings that need more work than setting a field,
+// like reading files.
+func (c *Config) finish() error {
+	if c.EndpointsFile != "" || len(c.FlagEndpoints) > 0 {
+		var endpoints []Endpoint
+		if c.EndpointsFile != "" {
+			fileEndpoints, err := LoadEndpoints(c.EndpointsFile)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			endpoints = append(endpoints, fileEndpoints...)
+		}
+		endpoints = append(endpoints, c.FlagEndpoints...)
+		c.Endpoints = endpoints
+	}
+
+	if c.Snapshot != "" {
+		if c.Monitor.Duration > 0 {
+			return errors.Errorf("-snapshot and -monitor can't be used together")
+		}
+		c.AppDataFolder = c.Snapshot
+	}
+
+	if c.Monitor.Interval <= 0 {
+		return errors.Errorf("monitor interval must be positive (got %s)", c.Monitor.Interval)
+	}
+
+	if c.Support.URL != "" {
+		err := checkSecureURL("support URL", c.Support.URL)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	} else if c.Support.Send {
+		return errors.Errorf("-send needs a support URL (see -support-url)")
+	}
+
+	// saved API keys are sent there
+	err := checkSecureURL("API base URL", c.APIProbe.BaseURL)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if c.Encryption.Enabled {
+		_, err := c.Encryption.PublicKey()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	for _, category := range c.Consent {
+		if !isDataCategory(category) {
+			return errors.Errorf("unknown data category %q", category)
+		}
+	}
+
+	for _, output := range c.Outputs {
+		_, _, err := parseOutput(output)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// stringListFlag collects comma-separated values, and can be repeated
+type stringListFlag struct {
+	values *[]string
+}
+
+func (sf *stringListFlag) String() string {
+	if sf.values == nil {
+		return ""
+	}
+	return strings.Join(*sf.values, ",")
+}
+
+func (sf *stringListFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			*sf.values = append(*sf.values, item)
+		}
+	}
+	return nil
+}
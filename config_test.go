@@ -0,0 +1,185 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseTestConfig(args []string) (*Config, error) {
+	c := DefaultConfig()
+	fs := flag.NewFlagSet("itch-diag", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	c.RegisterFlags(fs)
+	err := c.Parse(fs, args)
+	return c, err
+}
+
+func TestFindFlagValue(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-config", "a.json"}, "a.json"},
+		{[]string{"--config", "a.json"}, "a.json"},
+		{[]string{"-headless", "-config=a.json"}, "a.json"},
+		{[]string{"--config=a.json"}, "a.json"},
+		{[]string{"-config"}, ""},
+		{[]string{"-configs", "a.json"}, ""},
+		{[]string{"config", "a.json"}, ""},
+		{[]string{"--", "-config", "a.json"}, ""},
+		{nil, ""},
+	}
+	for _, test := range tests {
+		if got := findFlagValue(test.args, "config"); got != test.want {
+			t.Errorf("findFlagValue(%q) = %q, want %q", test.args, got, test.want)
+		}
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	folder, err := ioutil.TempDir("", "itch-diag-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	writeConfig := func(name string, contents string) string {
+		path := filepath.Join(folder, name)
+		err := ioutil.WriteFile(path, []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	configPath := writeConfig("config.json", `{
+		"headless": true,
+		"timeout-connect": "2s",
+		"appdata": "/from/file",
+		"output": ["json:report.json", "html:report.html"],
+		"consent": "system,network"
+	}`)
+	unknownPath := writeConfig("unknown.json", `{"headles": true}`)
+	invalidPath := writeConfig("invalid.json", `{"timeout-connect": "soon"}`)
+	nestedPath := writeConfig("nested.json", `{"config": "other.json"}`)
+
+	tests := []struct {
+		name    string
+		args    []string
+		check   func(t *testing.T, c *Config)
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, c *Config) {
+				if !reflect.DeepEqual(c, DefaultConfig()) {
+					t.Errorf("expected the default config, got %+v", c)
+				}
+			},
+		},
+		{
+			name: "flags",
+			args: []string{"-headless", "-checks", "proxy, hosts", "-skip-checks=installs", "-timeout-http", "5s"},
+			check: func(t *testing.T, c *Config) {
+				if !c.Headless || c.Timeouts.HTTP != 5*time.Second {
+					t.Errorf("flags weren't applied: %+v", c)
+				}
+				if !reflect.DeepEqual(c.Checks, []string{"proxy", "hosts"}) || !reflect.DeepEqual(c.SkipChecks, []string{"installs"}) {
+					t.Errorf("unexpected checks %v, skipped %v", c.Checks, c.SkipChecks)
+				}
+			},
+		},
+		{
+			name: "config file",
+			args: []string{"-config", configPath},
+			check: func(t *testing.T, c *Config) {
+				if !c.Headless || c.Timeouts.Connect != 2*time.Second || c.AppDataFolder != "/from/file" {
+					t.Errorf("settings weren't loaded: %+v", c)
+				}
+				if !reflect.DeepEqual(c.Outputs, []string{"json:report.json", "html:report.html"}) {
+					t.Errorf("arrays should set repeatable flags once per item, got %v", c.Outputs)
+				}
+				if !reflect.DeepEqual(c.Consent, []string{"system", "network"}) {
+					t.Errorf("unexpected consent %v", c.Consent)
+				}
+			},
+		},
+		{
+			name: "flags over config file",
+			args: []string{"-appdata", "/from/flags", "-config", configPath, "-timeout-connect=3s"},
+			check: func(t *testing.T, c *Config) {
+				if c.AppDataFolder != "/from/flags" || c.Timeouts.Connect != 3*time.Second {
+					t.Errorf("flags should win over the config file: %+v", c)
+				}
+				if !c.Headless {
+					t.Errorf("settings only in the config file should still apply")
+				}
+			},
+		},
+		{name: "missing config file", args: []string{"-config", filepath.Join(folder, "missing.json")}, wantErr: "missing.json"},
+		{name: "unknown setting", args: []string{"-config", unknownPath}, wantErr: `unknown setting "headles"`},
+		{name: "invalid value", args: []string{"-config", invalidPath}, wantErr: `invalid value for "timeout-connect"`},
+		{name: "nested config", args: []string{"-config", nestedPath}, wantErr: `unknown setting "config"`},
+		{name: "unknown data category", args: []string{"-consent", "system,passwords"}, wantErr: `unknown data category "passwords"`},
+		{name: "invalid output", args: []string{"-output", "pdf:report.pdf"}, wantErr: "pdf"},
+		{name: "snapshot and monitor", args: []string{"-snapshot", "/snapshot", "-monitor", "1m"}, wantErr: "can't be used together"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := parseTestConfig(test.args)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			test.check(t, c)
+		})
+	}
+}
+
+func TestValidateCheckIDs(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr string
+	}{
+		{nil, ""},
+		{[]string{"-checks", "connectivity,hosts", "-skip-checks", "installs"}, ""},
+		{[]string{"-checks", "conectivity"}, `unknown check "conectivity" in -checks`},
+		{[]string{"-skip-checks", "instals"}, `unknown check "instals" in -skip-checks`},
+	}
+
+	for _, test := range tests {
+		c, err := parseTestConfig(test.args)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		a := newTestApp()
+		a.config = c
+
+		err = a.ValidateCheckIDs()
+		if test.wantErr == "" {
+			if err != nil {
+				t.Errorf("%v: %+v", test.args, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%v: expected an error containing %q, got %v", test.args, test.wantErr, err)
+			continue
+		}
+		// the valid ones are listed
+		if !strings.Contains(err.Error(), "connectivity, ranges") {
+			t.Errorf("expected the valid checks to be listed, got %v", err)
+		}
+	}
+}
@@ -1,36 +1,385 @@
 package main
 
 import (
+	"crypto/tls"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/itchio/httpkit/timeout"
+	"github.com/itchio/headway/united"
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
 )
 
+// cdnHeaders are response headers that tell us which CDN (and which edge)
+// served a request.
+var cdnHeaders = []string{
+	"Server",
+	"Via",
+	"Age",
+	"X-Cache",
+	"X-Cache-Hits",
+	"X-Served-By",
+	"CF-Ray",
+	"CF-Cache-Status",
+	"X-Amz-Cf-Pop",
+	"X-Amz-Cf-Id",
+}
+
 func (a *App) DiagnoseConnectivity() error {
-	a.TestEndpoint("https://static.itch.io/ping.txt")
-	a.TestEndpoint("https://itch.io/static/ping.txt")
-	a.TestEndpoint("https://broth.itch.ovh")
+	var results []*EndpointResult
+	for _, ep := range a.config.Endpoints {
+		results = append(results, a.TestEndpoint(ep)...)
+	}
+
+	seenHosts := make(map[string]bool)
+	for _, ep := range a.config.Endpoints {
+		host, port, err := endpointHostPort(ep.URL)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if seenHosts[host] {
+			continue
+		}
+		seenHosts[host] = true
+		a.TestIPFamilies(host, port)
+	}
+
+	a.CheckClockSkew(results)
 
 	return nil
 }
 
-func (a *App) TestEndpoint(endpoint string) {
+// EndpointTimings is a per-phase breakdown of an HTTP request
+type EndpointTimings struct {
+	DNS       time.Duration
+	Connect   time.Duration
+	TLS       time.Duration
+	FirstByte time.Duration
+	Transfer  time.Duration
+}
+
+// endpointTrace collects timings and addresses from httptrace hooks,
+// which may be called from several goroutines.
+type endpointTrace struct {
+	mu sync.Mutex
+
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	wroteRequest time.Time
+
+	timings     EndpointTimings
+	resolved    []string
+	connectedTo string
+}
+
+func (et *endpointTrace) ClientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			et.mu.Lock()
+			defer et.mu.Unlock()
+			et.dnsStart = time.Now()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			et.mu.Lock()
+			defer et.mu.Unlock()
+			et.timings.DNS = time.Since(et.dnsStart)
+			for _, addr := range info.Addrs {
+				et.resolved = append(et.resolved, addr.String())
+			}
+		},
+		ConnectStart: func(network, addr string) {
+			et.mu.Lock()
+			defer et.mu.Unlock()
+			if et.connectStart.IsZero() {
+				et.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(network, addr string, err error) {
+			et.mu.Lock()
+			defer et.mu.Unlock()
+			if err == nil {
+				et.timings.Connect = time.Since(et.connectStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			et.mu.Lock()
+			defer et.mu.Unlock()
+			et.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			et.mu.Lock()
+			defer et.mu.Unlock()
+			et.timings.TLS = time.Since(et.tlsStart)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			et.mu.Lock()
+			defer et.mu.Unlock()
+			et.connectedTo = info.Conn.RemoteAddr().String()
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			et.mu.Lock()
+			defer et.mu.Unlock()
+			et.wroteRequest = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			et.mu.Lock()
+			defer et.mu.Unlock()
+			et.timings.FirstByte = time.Since(et.wroteRequest)
+		},
+	}
+}
+
+// newDiagClient returns an http client similar to the one butler uses,
+// except it dials with the request's context so that DNS and connect
+// phases show up in httptrace. If proxyURL is nil, it connects directly.
+// Connections aren't kept alive: clients are dropped after a few requests,
+// and idle connections would pile up during long monitoring runs.
+func (a *App) newDiagClient(proxyURL *url.URL) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: a.config.Timeouts.Connect,
+	}
+	transport := &http.Transport{
+		DialContext:       dialer.DialContext,
+		DisableKeepAlives: true,
+	}
+	if proxyURL != nil {
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	http2.ConfigureTransport(transport)
+	return &http.Client{
+		Transport: transport,
+		Timeout:   a.config.Timeouts.HTTP,
+	}
+}
+
+// maxKeptBody is how much of a response body we keep around for inspection
+const maxKeptBody = 64 * 1024
+
+// RedirectHop is a redirect we followed while requesting an endpoint
+type RedirectHop struct {
+	From       string
+	To         string
+	StatusCode int
+}
+
+// EndpointResult is what we learned by requesting an endpoint once
+type EndpointResult struct {
+	Endpoint string
+	Proxy    *url.URL
+
+	StatusCode int
+	Proto      string
+	TLS        *tls.ConnectionState
+	Header     http.Header
+	Body       []byte
+	BodySize   int64
+	Redirects  []RedirectHop
+
+	Duration    time.Duration
+	ReceivedAt  time.Time
+	Timings     EndpointTimings
+	Resolved    []string
+	ConnectedTo string
+}
+
+// ProbeEndpoint requests endpoint once, either directly or through proxyURL
+func (a *App) ProbeEndpoint(endpoint string, proxyURL *url.URL) (*EndpointResult, error) {
 	startTime := time.Now()
 
 	req, err := http.NewRequest("GET", endpoint, nil)
 	if err != nil {
-		a.Errorf("<code>%s</code>: %+v", endpoint, err)
-		return
+		return nil, errors.WithStack(err)
+	}
+
+	et := &endpointTrace{}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), et.ClientTrace()))
+
+	var redirects []RedirectHop
+	client := a.newDiagClient(proxyURL)
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.Errorf("stopped after 10 redirects")
+		}
+		hop := RedirectHop{
+			From: via[len(via)-1].URL.String(),
+			To:   req.URL.String(),
+		}
+		if req.Response != nil {
+			hop.StatusCode = req.Response.StatusCode
+		}
+		redirects = append(redirects, hop)
+		return nil
 	}
 
-	client := timeout.NewDefaultClient()
 	res, err := client.Do(req)
 	if err != nil {
-		a.Errorf("<code>%s</code>: %+v", endpoint, err)
-		return
+		return nil, errors.WithStack(err)
 	}
 	defer res.Body.Close()
+	receivedAt := time.Now()
+
+	transferStart := time.Now()
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxKeptBody))
+	if err != nil {
+		return nil, errors.Wrap(err, "while reading body")
+	}
+	restSize, err := io.Copy(ioutil.Discard, res.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "while reading body")
+	}
+	bodySize := int64(len(body)) + restSize
 
-	a.Infof("<code>%s</code>: HTTP %d (in %s)", endpoint, res.StatusCode, time.Since(startTime))
+	et.mu.Lock()
+	defer et.mu.Unlock()
+	et.timings.Transfer = time.Since(transferStart)
+
+	result := &EndpointResult{
+		Endpoint: endpoint,
+		Proxy:    proxyURL,
+
+		StatusCode: res.StatusCode,
+		Proto:      res.Proto,
+		TLS:        res.TLS,
+		Header:     res.Header,
+		Body:       body,
+		BodySize:   bodySize,
+		Redirects:  redirects,
+
+		Duration:    time.Since(startTime),
+		ReceivedAt:  receivedAt,
+		Timings:     et.timings,
+		Resolved:    et.resolved,
+		ConnectedTo: et.connectedTo,
+	}
+	return result, nil
+}
+
+// TestEndpoint probes an endpoint directly and, if one is configured,
+// through a proxy. It returns the results of successful probes.
+func (a *App) TestEndpoint(ep Endpoint) []*EndpointResult {
+	endpoint := ep.URL
+
+	proxyURL, err := EndpointProxy(endpoint)
+	if err != nil {
+		a.Errorf("<code>%s</code>: %+v", endpoint, err)
+		return nil
+	}
+
+	a.Debugf("Probing %s endpoint <code>%s</code>", ep.Purpose, endpoint)
+
+	if proxyURL == nil {
+		res, err := a.ProbeEndpoint(endpoint, nil)
+		if err != nil {
+			a.LogEndpointError(ep.Severity, endpoint, nil, err)
+			return nil
+		}
+		a.LogEndpointResult(res)
+		a.CheckEndpointResult(ep, res)
+		return []*EndpointResult{res}
+	}
+
+	var results []*EndpointResult
+
+	proxyLabel := displayProxy(proxyURL.String())
+
+	proxyRes, proxyErr := a.ProbeEndpoint(endpoint, proxyURL)
+	if proxyErr != nil {
+		a.LogEndpointError(ep.Severity, endpoint, proxyURL, proxyErr)
+	} else {
+		a.LogEndpointResult(proxyRes)
+		a.CheckEndpointResult(ep, proxyRes)
+		results = append(results, proxyRes)
+	}
+
+	directRes, directErr := a.ProbeEndpoint(endpoint, nil)
+	if directErr != nil {
+		a.LogEndpointError("warn", endpoint, nil, directErr)
+	} else {
+		a.LogEndpointResult(directRes)
+		a.CheckEndpointResult(ep, directRes)
+		results = append(results, directRes)
+	}
+
+	switch {
+	case proxyErr == nil && directErr == nil:
+		a.Infof("Going through proxy <code>%s</code> takes %s instead of %s",
+			proxyLabel, formatDuration(proxyRes.Duration), formatDuration(directRes.Duration))
+		if proxyRes.StatusCode != directRes.StatusCode {
+			a.Warnf("Proxy <code>%s</code> changes the response: HTTP %d instead of HTTP %d",
+				proxyLabel, proxyRes.StatusCode, directRes.StatusCode)
+		}
+	case proxyErr != nil && directErr == nil:
+		a.Logf(ep.Severity, "Proxy <code>%s</code> is breaking access to <code>%s</code>, which is reachable directly", proxyLabel, endpoint)
+	case proxyErr == nil && directErr != nil:
+		a.Infof("<code>%s</code> is only reachable through proxy <code>%s</code>", endpoint, proxyLabel)
+	}
+
+	return results
+}
+
+func (a *App) LogEndpointResult(res *EndpointResult) {
+	via := "direct"
+	if res.Proxy != nil {
+		via = fmt.Sprintf("through proxy <code>%s</code>", displayProxy(res.Proxy.String()))
+	}
+	a.Infof("<code>%s</code> (%s): HTTP %d (in %s)", res.Endpoint, via, res.StatusCode, formatDuration(res.Duration))
+	route := "direct"
+	if res.Proxy != nil {
+		route = "proxy"
+	}
+	a.RecordValue(fmt.Sprintf("%s status (%s)", res.Endpoint, route), fmt.Sprintf("HTTP %d", res.StatusCode))
+	a.RecordValue(fmt.Sprintf("%s latency (%s)", res.Endpoint, route), formatDuration(res.Duration))
+	for i, hop := range res.Redirects {
+		a.Infof("Redirect #%d: HTTP %d from <code>%s</code> to <code>%s</code>", i+1, hop.StatusCode, html.EscapeString(hop.From), html.EscapeString(hop.To))
+	}
+
+	a.InfoGroup().
+		Item("DNS %s", formatDuration(res.Timings.DNS)).
+		Item("Connect %s", formatDuration(res.Timings.Connect)).
+		Item("TLS %s", formatDuration(res.Timings.TLS)).
+		Item("First byte %s", formatDuration(res.Timings.FirstByte)).
+		Item("Transfer %s (%s)", formatDuration(res.Timings.Transfer), united.FormatBytes(res.BodySize)).
+		End()
+
+	protocol := res.Proto
+	if res.TLS != nil && res.TLS.NegotiatedProtocol != "" {
+		protocol = fmt.Sprintf("%s (ALPN <code>%s</code>)", protocol, html.EscapeString(res.TLS.NegotiatedProtocol))
+	}
+	a.InfoGroup().
+		Item("Resolved to <code>%s</code>", strings.Join(res.Resolved, ", ")).
+		Item("Connected to <code>%s</code>", res.ConnectedTo).
+		Item("Protocol %s", protocol).
+		End()
+
+	var headers []string
+	for _, name := range cdnHeaders {
+		value := res.Header.Get(name)
+		if value != "" {
+			headers = append(headers, fmt.Sprintf("<code>%s: %s</code>", name, html.EscapeString(value)))
+		}
+	}
+	if len(headers) > 0 {
+		a.Infof("CDN headers: %s", strings.Join(headers, ", "))
+	}
+
+	if res.TLS != nil {
+		a.LogCertificateChain(res.Endpoint, res.TLS)
+	}
+}
+
+func formatDuration(d time.Duration) string {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond).String()
+	}
+	return d.Round(time.Millisecond).String()
 }
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// Data categories, see dataCategories
+const (
+	CategorySystem   = "system"
+	CategoryPaths    = "paths"
+	CategoryProfiles = "profiles"
+	CategoryLogs     = "logs"
+	CategoryDatabase = "database"
+	CategoryNetwork  = "network"
+)
+
+// DataCategory is a kind of data that ends up in reports, which the user
+// can choose not to share.
+type DataCategory struct {
+	ID          string
+	Label       string
+	Description string
+}
+
+// dataCategories lists everything itch-diag may collect, in the order
+// they're shown on the consent screen.
+var dataCategories = []DataCategory{
+	{
+		ID:          CategorySystem,
+		Label:       "System information",
+		Description: "Operating system version, security software, versions of itch-setup",
+	},
+	{
+		ID:          CategoryPaths,
+		Label:       "Paths",
+		Description: "Where the itch app, its dependencies and your games are installed, and what those folders contain",
+	},
+	{
+		ID:          CategoryProfiles,
+		Label:       "Profiles",
+		Description: "Which itch.io accounts are saved in the app, and whether their sessions are still valid",
+	},
+	{
+		ID:          CategoryLogs,
+		Label:       "Logs",
+		Description: "Log files written by the itch app",
+	},
+	{
+		ID:          CategoryDatabase,
+		Label:       "Database stats",
+		Description: "Size and number of records of the itch app's local database",
+	},
+	{
+		ID:          CategoryNetwork,
+		Label:       "Network",
+		Description: "Proxy settings, hosts file entries, DNS answers, and how itch.io servers respond",
+	},
+}
+
+func isDataCategory(id string) bool {
+	for _, category := range dataCategories {
+		if category.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// sortCategories removes duplicates, and sorts categories in the order
+// they're shown on the consent screen
+func sortCategories(categories []string) []string {
+	var sorted []string
+	for _, category := range dataCategories {
+		if containsString(categories, category.ID) {
+			sorted = append(sorted, category.ID)
+		}
+	}
+	return sorted
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// AskConsent lets the user pick which categories of collected data
+// end up in reports, and drops the others. In headless mode, the
+// categories come from the config instead.
+func (a *App) AskConsent() {
+	if a.consentAsked {
+		return
+	}
+	a.consentAsked = true
+
+	collected := a.report.Categories()
+	if a.wantsBundle() {
+		collected = append(collected, CategoryLogs)
+		// past reports go in bundles too
+		history, _ := a.bundledHistory()
+		for _, past := range history {
+			collected = append(collected, past.Categories()...)
+		}
+		collected = sortCategories(collected)
+	}
+	if len(collected) == 0 {
+		return
+	}
+
+	var consent []string
+	if a.w == nil {
+		consent = a.config.Consent
+		if len(consent) == 0 {
+			consent = collected
+		}
+	} else {
+		a.showConsentScreen(collected)
+		msg := &ConsentMessage{}
+		a.Receive(&msg)
+		consent = msg.Consent
+	}
+
+	var withheld []string
+	for _, category := range collected {
+		if !containsString(consent, category) {
+			withheld = append(withheld, category)
+		}
+	}
+	if len(withheld) == 0 {
+		return
+	}
+
+	a.report.Withhold(withheld)
+	a.Infof("Left out of the report, as requested: %s", strings.Join(withheld, ", "))
+}
+
+// wantsBundle returns true if a bundle, which includes logs, will be
+// written or sent.
+func (a *App) wantsBundle() bool {
+	if a.config.Support.URL != "" && a.config.Encryption.Enabled {
+		return true
+	}
+	for _, spec := range a.config.Outputs {
+		format, _, err := parseOutput(spec)
+		if err == nil && format == "bundle" {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *App) showConsentScreen(collected []string) {
+	var form strings.Builder
+	form.WriteString("<h3>Before saving the report</h3>")
+	form.WriteString("<p>Here's what itch-diag collected. Uncheck anything you'd rather not share: it'll be left out of the report.</p>")
+	if a.KeepsHistory() {
+		historyFolder, _ := a.HistoryFolder()
+		fmt.Fprintf(&form, "<p>The report is also kept in <code>%s</code> (the last %d runs), so the next run can point out what changed. Unchecked data is left out there too.</p>",
+			html.EscapeString(historyFolder), maxHistory)
+	}
+	for _, category := range dataCategories {
+		if !containsString(collected, category.ID) {
+			continue
+		}
+		checked := ""
+		if len(a.config.Consent) == 0 || containsString(a.config.Consent, category.ID) {
+			checked = " checked"
+		}
+		fmt.Fprintf(&form, `<label><input type="checkbox" value="%s"%s> <strong>%s</strong> — %s</label>`,
+			category.ID, checked, html.EscapeString(category.Label), html.EscapeString(category.Description))
+	}
+	form.WriteString(`<button id="consent-submit">Save report</button>`)
+
+	payload, err := json.Marshal(form.String())
+	a.Must(err)
+
+	a.Eval(`
+		var form = document.createElement("div");
+		form.className = "consent";
+		form.innerHTML = ` + string(payload) + `;
+		document.querySelector("#app").appendChild(form);
+		form.scrollIntoView();
+
+		form.querySelector("#consent-submit").addEventListener("click", function () {
+			var consent = [];
+			var inputs = form.querySelectorAll("input[type=checkbox]");
+			for (var i = 0; i < inputs.length; i++) {
+				if (inputs[i].checked) {
+					consent.push(inputs[i].value);
+				}
+			}
+			form.parentNode.removeChild(form);
+			window.external.invoke(JSON.stringify({
+				Consent: consent
+			}));
+		});
+	`)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// supportPublicKey is the key support bundles are encrypted to by default.
+// It's set at build time, with:
+//
+//   go build -ldflags "-X main.supportPublicKey=<base64 key>"
+var supportPublicKey string
+
+// EncryptionConfig controls the encryption of support bundles
+type EncryptionConfig struct {
+	Enabled bool
+	// Key is the base64-encoded public key to encrypt to, if not the
+	// one built into itch-diag
+	Key string
+}
+
+// PublicKey returns the key bundles should be encrypted to
+func (ec EncryptionConfig) PublicKey() (*[32]byte, error) {
+	encoded := ec.Key
+	if encoded == "" {
+		encoded = supportPublicKey
+	}
+	if encoded == "" {
+		return nil, errors.Errorf("no public key to encrypt to: this build has none, see -encrypt-key")
+	}
+	return decodeKey(encoded)
+}
+
+// bundleMagic starts every encrypted bundle. It's followed by the sender's
+// ephemeral public key, the nonce, and the sealed zip file.
+var bundleMagic = []byte("itchdiag-box-v1\n")
+
+// EncryptBundle seals data so that only the owner of the private key
+// matching publicKey can open it. A new keypair is generated every time,
+// so the sender doesn't need a key of their own.
+func EncryptBundle(data []byte, publicKey *[32]byte) ([]byte, error) {
+	ephemeralPublic, ephemeralPrivate, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var nonce [24]byte
+	_, err = rand.Read(nonce[:])
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	out := make([]byte, 0, len(bundleMagic)+len(ephemeralPublic)+len(nonce)+len(data)+box.Overhead)
+	out = append(out, bundleMagic...)
+	out = append(out, ephemeralPublic[:]...)
+	out = append(out, nonce[:]...)
+	return box.Seal(out, data, &nonce, publicKey, ephemeralPrivate), nil
+}
+
+// DecryptBundle opens a bundle sealed by EncryptBundle
+func DecryptBundle(sealed []byte, privateKey *[32]byte) ([]byte, error) {
+	if !bytes.HasPrefix(sealed, bundleMagic) {
+		return nil, errors.Errorf("not an encrypted itch-diag bundle")
+	}
+	sealed = sealed[len(bundleMagic):]
+	if len(sealed) < 32+24+box.Overhead {
+		return nil, errors.Errorf("encrypted bundle is truncated")
+	}
+
+	var ephemeralPublic [32]byte
+	copy(ephemeralPublic[:], sealed[:32])
+	var nonce [24]byte
+	copy(nonce[:], sealed[32:56])
+
+	data, ok := box.Open(nil, sealed[56:], &nonce, &ephemeralPublic, privateKey)
+	if !ok {
+		return nil, errors.Errorf("could not decrypt bundle: wrong key, or corrupted file")
+	}
+	return data, nil
+}
+
+func encodeKey(key *[32]byte) string {
+	return base64.StdEncoding.EncodeToString(key[:])
+}
+
+func decodeKey(encoded string) (*[32]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding key")
+	}
+	if len(decoded) != 32 {
+		return nil, errors.Errorf("invalid key: should be 32 bytes, got %d", len(decoded))
+	}
+
+	var key [32]byte
+	copy(key[:], decoded)
+	return &key, nil
+}
+
+// RunKeygen generates a keypair for support staff. The public key can be
+// passed to -encrypt-key or built into itch-diag.
+func RunKeygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	name := fs.String("out", "itch-diag-support", "Write keys to `name`.key (private) and name.pub (public)")
+	err := fs.Parse(args)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	publicKey, privateKey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = ioutil.WriteFile(*name+".key", []byte(encodeKey(privateKey)+"\n"), 0600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	err = ioutil.WriteFile(*name+".pub", []byte(encodeKey(publicKey)+"\n"), 0644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	fmt.Printf("Wrote %s.key and %s.pub\n", *name, *name)
+	fmt.Printf("Public key: %s\n", encodeKey(publicKey))
+	return nil
+}
+
+// RunDecrypt opens an encrypted bundle with a private key
+func RunDecrypt(args []string) error {
+	fs := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	keyFile := fs.String("key", "itch-diag-support.key", "File containing the private key")
+	out := fs.String("out", "", "Where to write the decrypted bundle (default: input without .enc)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: itch-diag decrypt [options] bundle.zip.enc\n")
+		fs.PrintDefaults()
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	in := fs.Arg(0)
+
+	encodedKey, err := ioutil.ReadFile(*keyFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	privateKey, err := decodeKey(string(encodedKey))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	sealed, err := ioutil.ReadFile(in)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	data, err := DecryptBundle(sealed, privateKey)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if *out == "" {
+		*out = strings.TrimSuffix(in, ".enc")
+		if *out == in {
+			*out = in + ".zip"
+		}
+	}
+	err = ioutil.WriteFile(*out, data, 0600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	fmt.Printf("Wrote %s\n", *out)
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+func TestEncryptBundle(t *testing.T) {
+	publicKey, privateKey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := []byte("PK\x03\x04 not really a zip file")
+	sealed, err := EncryptBundle(bundle, publicKey)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if bytes.Contains(sealed, bundle) {
+		t.Fatalf("the sealed bundle contains the plain one")
+	}
+
+	data, err := DecryptBundle(sealed, privateKey)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if !bytes.Equal(data, bundle) {
+		t.Errorf("round trip changed the bundle: got %q", data)
+	}
+
+	badMagic := append([]byte(nil), sealed...)
+	badMagic[0] = 'X'
+
+	tests := []struct {
+		name    string
+		sealed  []byte
+		key     *[32]byte
+		wantErr string
+	}{
+		{"wrong key", sealed, otherKey, "wrong key, or corrupted file"},
+		{"corrupted", corrupt(sealed, len(sealed)-1), privateKey, "wrong key, or corrupted file"},
+		{"truncated", sealed[:len(bundleMagic)+40], privateKey, "truncated"},
+		{"bad magic", badMagic, privateKey, "not an encrypted itch-diag bundle"},
+		{"empty", nil, privateKey, "not an encrypted itch-diag bundle"},
+	}
+	for _, test := range tests {
+		_, err := DecryptBundle(test.sealed, test.key)
+		if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: expected an error containing %q, got %v", test.name, test.wantErr, err)
+		}
+	}
+}
+
+func TestKeygenAndDecrypt(t *testing.T) {
+	folder, err := ioutil.TempDir("", "itch-diag-crypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	name := filepath.Join(folder, "support")
+
+	err = RunKeygen([]string{"-out", name})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	encodedPublic, err := ioutil.ReadFile(name + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := EncryptionConfig{Key: string(encodedPublic)}.PublicKey()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(name + ".key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm()&0077 != 0 {
+			t.Errorf("the private key should only be readable by its owner, got %v", info.Mode())
+		}
+	}
+
+	bundle := []byte("PK\x03\x04 a bundle")
+	sealed, err := EncryptBundle(bundle, publicKey)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	sealedPath := filepath.Join(folder, "bundle.zip.enc")
+	err = ioutil.WriteFile(sealedPath, sealed, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = RunDecrypt([]string{"-key", name + ".key", sealedPath})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(folder, "bundle.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, bundle) {
+		t.Errorf("decrypted bundle differs: got %q", data)
+	}
+}
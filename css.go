@@ -44,6 +44,33 @@ const baseCSS = `
 	
 	i { font-variant: italic; }
 
+	table.monitor {
+		border-collapse: collapse;
+		margin: 10px 0;
+	}
+
+	table.monitor th, table.monitor td {
+		text-align: left;
+		padding: 2px 10px;
+		border-bottom: 1px solid #383434;
+	}
+
+	div.consent {
+		margin: 10px 0;
+		padding: 10px;
+		border-radius: 2px;
+		background: #383434;
+	}
+
+	div.consent label {
+		display: block;
+		margin: 0.4em 0;
+	}
+
+	div.consent button {
+		margin-top: 10px;
+	}
+
 	p.level-debug { color: #77aaea; }
 	p.level-success { color: #66ab66; }
 	p.level-info { color: white; }
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/itchio/headway/united"
+	"github.com/pkg/errors"
+)
+
+// DiagnoseDatabase reports the size of butler.db and how many records
+// each of its tables holds.
+func (a *App) DiagnoseDatabase() error {
+	appDataFolder, err := a.GetAppDataFolder()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	dbPath := filepath.Join(appDataFolder, "db", "butler.db")
+	stats, err := a.fs.Stat(dbPath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	a.Infof("butler.db takes up <code>%s</code>", united.FormatBytes(stats.Size()))
+
+	if walStats, err := a.fs.Stat(dbPath + "-wal"); err == nil && walStats.Size() > 0 {
+		a.Infof("Its write-ahead log takes up <code>%s</code>", united.FormatBytes(walStats.Size()))
+	}
+
+	db, err := openSQLite(a.fs, dbPath)
+	if err != nil {
+		a.Errorf("Could not read butler.db: %s", err.Error())
+		return nil
+	}
+	defer db.Close()
+
+	tables, err := db.Tables()
+	if err != nil {
+		a.Errorf("Could not list butler.db tables, it may be corrupted: %s", err.Error())
+		return nil
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+
+	group := a.InfoGroup()
+	for _, table := range tables {
+		table := table
+		count, err := db.Count(&table)
+		if err != nil {
+			a.Errorf("Could not read table <code>%s</code>, it may be corrupted: %s", table.Name, err.Error())
+			continue
+		}
+		group.Item("<code>%s</code>: %d", table.Name, count)
+	}
+	group.End()
+
+	return nil
+}
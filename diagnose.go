@@ -1,16 +1,10 @@
 package main
 
-import (
-	"runtime"
-)
-
-const diagnoseUserAgent = false
-
 // Diagnose runs a battery of tests.
 func (a *App) Diagnose() {
 	a.Debugf("Running diagnostics (itch-diag v%s)...", ItchDiagVersion)
 
-	if diagnoseUserAgent {
+	if a.config.UserAgent && a.w != nil {
 		a.Eval(`
 		window.external.invoke(JSON.stringify({
 			UserAgent: window.navigator.userAgent
@@ -21,13 +15,33 @@ func (a *App) Diagnose() {
 		a.Infof("User-Agent is: %s", msg.UserAgent)
 	}
 
-	switch runtime.GOOS {
-	case "windows":
-		a.DiagnoseWindows()
+	if a.config.Snapshot != "" {
+		a.Infof("Analyzing snapshot <code>%s</code>, checks that run programs or use the network are skipped", a.config.Snapshot)
 	}
 
-	a.Test("Diagnosing internet connectivity", a.DiagnoseConnectivity)
-	a.Test("Diagnosing itch app dependencies", a.DiagnoseAppData)
+	if a.config.Monitor.Duration > 0 {
+		a.RunCheck(Check{ID: "monitor", Label: "Monitoring connectivity", Run: a.MonitorConnectivity, Category: CategoryNetwork})
+	} else {
+		for _, check := range a.Checks() {
+			if !a.config.ShouldRun(check) {
+				a.report.Skip(check)
+				continue
+			}
+			a.RunCheck(check)
+		}
+		a.CompareWithHistory()
+	}
 
 	a.Debugf("All done!")
+	a.LogRedactions()
+	a.report.Finish()
+	a.SaveReports()
+
+	if a.config.Support.URL != "" {
+		if a.config.Support.Send {
+			a.SendToSupport()
+		} else if a.w != nil {
+			a.OfferSupportUpload()
+		}
+	}
 }
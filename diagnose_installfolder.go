@@ -2,12 +2,9 @@ package main
 
 import (
 	"encoding/json"
-	"io/ioutil"
-	"os"
 	"path/filepath"
 
 	"github.com/itchio/headway/united"
-	"github.com/itchio/lake/tlc"
 	"github.com/pkg/errors"
 )
 
@@ -19,7 +16,7 @@ type InstallState struct {
 func (a *App) DiagnoseInstallFolder(installFolder string) error {
 	a.Infof("Install folder is <code>%s</code>", installFolder)
 
-	stats, err := os.Stat(installFolder)
+	stats, err := a.fs.Stat(installFolder)
 	if err != nil {
 		a.Errorf("While stat-ing install folder: %+v", err)
 		return nil
@@ -33,7 +30,7 @@ func (a *App) DiagnoseInstallFolder(installFolder string) error {
 	stateJsonPath := filepath.Join(installFolder, "state.json")
 
 	var installState InstallState
-	stateJsonContents, err := ioutil.ReadFile(stateJsonPath)
+	stateJsonContents, err := a.fs.ReadFile(stateJsonPath)
 	if err != nil {
 		a.Errorf("While reading install state: %+v", err)
 		return nil
@@ -58,9 +55,7 @@ func (a *App) DiagnoseInstallFolder(installFolder string) error {
 
 	currentVersionFolder := filepath.Join(installFolder, "app-"+installState.Current)
 
-	container, err := tlc.WalkDir(currentVersionFolder, &tlc.WalkOpts{
-		Filter: func(fi os.FileInfo) bool { return true },
-	})
+	container, err := WalkFolder(a.fs, currentVersionFolder)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiagnoseInstallFolder(t *testing.T) {
+	installFolder := filepath.Join(string(filepath.Separator)+"fixture", "itch")
+	statePath := filepath.Join(installFolder, "state.json")
+	appFolder := filepath.Join(installFolder, "app-26.1.0")
+
+	tests := []struct {
+		name  string
+		setup func(fs *MemFS)
+		level string
+		want  string
+	}{
+		{
+			name: "healthy",
+			setup: func(fs *MemFS) {
+				fs.AddFile(statePath, []byte(`{"current": "26.1.0"}`))
+				fs.AddFile(filepath.Join(appFolder, "itch"), []byte("ELF"))
+			},
+			level: "info",
+			want:  "Current version takes up",
+		},
+		{
+			name:  "missing folder",
+			setup: func(fs *MemFS) {},
+			level: "error",
+			want:  "While stat-ing install folder",
+		},
+		{
+			name:  "not a folder",
+			setup: func(fs *MemFS) { fs.AddFile(installFolder, nil) },
+			level: "error",
+			want:  "not a directory",
+		},
+		{
+			name:  "unreadable state",
+			setup: func(fs *MemFS) { fs.AddError(statePath, os.ErrPermission) },
+			level: "error",
+			want:  "While reading install state",
+		},
+		{
+			name:  "malformed state",
+			setup: func(fs *MemFS) { fs.AddFile(statePath, []byte(`{"current":`)) },
+			level: "error",
+			want:  "While decoding install state",
+		},
+		{
+			name:  "no current version",
+			setup: func(fs *MemFS) { fs.AddFile(statePath, []byte(`{}`)) },
+			level: "error",
+			want:  "No current version",
+		},
+		{
+			name: "pending update",
+			setup: func(fs *MemFS) {
+				fs.AddFile(statePath, []byte(`{"current": "26.1.0", "ready": "26.2.0"}`))
+			},
+			level: "warn",
+			want:  "<code>26.2.0</code> is ready for update",
+		},
+		{
+			name: "empty version folder",
+			setup: func(fs *MemFS) {
+				fs.AddFile(statePath, []byte(`{"current": "26.1.0"}`))
+				fs.AddFile(filepath.Join(appFolder, "itch"), nil)
+			},
+			level: "error",
+			want:  "Install folder seems empty",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := NewMemFS()
+			test.setup(fs)
+
+			a := newTestApp()
+			a.fs = fs
+			err := a.DiagnoseInstallFolder(installFolder)
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			assertEntry(t, a.report, test.level, test.want)
+		})
+	}
+}
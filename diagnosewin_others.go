@@ -2,6 +2,7 @@
 
 package main
 
-func (a *App) DiagnoseWindows() {
+func (a *App) PlatformChecks() []Check {
 	// nothing
+	return nil
 }
@@ -11,11 +11,13 @@ import (
 	"golang.org/x/sys/windows/registry"
 )
 
-func (a *App) DiagnoseWindows() {
-	a.Test("Collecting OS information", a.CollectOSInfo)
-	a.Test("Collecting Security Center information", a.CollectSecurityInfo)
-	a.Test("Verifying null service", a.DiagnoseNUL)
-	a.Test("Verifying installed app information", a.DiagnoseItchReg)
+func (a *App) PlatformChecks() []Check {
+	return []Check{
+		{ID: "os-info", Label: "Collecting OS information", Run: a.CollectOSInfo, Category: CategorySystem},
+		{ID: "security-center", Label: "Collecting Security Center information", Run: a.CollectSecurityInfo, Category: CategorySystem},
+		{ID: "null-service", Label: "Verifying null service", Run: a.DiagnoseNUL, Category: CategorySystem},
+		{ID: "itch-reg", Label: "Verifying installed app information", Run: a.DiagnoseItchReg, Category: CategoryPaths, OptIn: a.config.InstallFolder != ""},
+	}
 }
 
 const nullServiceRegPath = "SYSTEM\\ControlSet001\\Services\\Null"
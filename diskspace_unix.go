@@ -0,0 +1,19 @@
+//+build !windows
+
+package main
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// diskFreeSpace returns how many bytes are available to us on the
+// filesystem containing path
+func diskFreeSpace(path string) (int64, error) {
+	var stat unix.Statfs_t
+	err := unix.Statfs(path, &stat)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/itchio/headway/united"
+	"github.com/pkg/errors"
+)
+
+const downloadTestTimeout = 10 * time.Minute
+
+// maxVerifiedArchive is how large a download can be for its contents to be
+// checked, when no SHA-256 is configured.
+const maxVerifiedArchive = 256 * 1024 * 1024
+
+// DiagnoseDownload downloads a large object from the CDN, measures
+// sustained throughput and verifies it arrived intact.
+func (a *App) DiagnoseDownload() error {
+	cfg := a.config.DownloadTest
+
+	proxyURL, err := EndpointProxy(cfg.URL)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	req, err := http.NewRequest("GET", cfg.URL, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	client := a.newDiagClient(proxyURL)
+	client.Timeout = downloadTestTimeout
+
+	startTime := time.Now()
+	res, err := client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return errors.Errorf("%s: HTTP %d", cfg.URL, res.StatusCode)
+	}
+	if res.ContentLength >= 0 {
+		a.Debugf("Downloading <code>%s</code> (%s)...", cfg.URL, united.FormatBytes(res.ContentLength))
+	} else {
+		a.Debugf("Downloading <code>%s</code> (unknown size)...", cfg.URL)
+	}
+
+	hasher := sha256.New()
+	// without an expected hash, keep the download around to check the
+	// archive it contains
+	var archive *bytes.Buffer
+	if cfg.SHA256 == "" && res.ContentLength <= maxVerifiedArchive {
+		archive = &bytes.Buffer{}
+	}
+	buf := make([]byte, 32*1024)
+	var received int64
+	var peakBPS float64
+	bucketStart := time.Now()
+	var bucketBytes int64
+	transferStart := time.Now()
+
+	for {
+		n, readErr := res.Body.Read(buf)
+		if n > 0 {
+			hasher.Write(buf[:n])
+			if archive != nil {
+				if archive.Len()+n > maxVerifiedArchive {
+					archive = nil
+				} else {
+					archive.Write(buf[:n])
+				}
+			}
+			received += int64(n)
+			bucketBytes += int64(n)
+
+			if elapsed := time.Since(bucketStart); elapsed > time.Second {
+				bps := float64(bucketBytes) / elapsed.Seconds()
+				if bps > peakBPS {
+					peakBPS = bps
+				}
+				bucketStart = time.Now()
+				bucketBytes = 0
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			a.Errorf("Download interrupted after %s: %+v", united.FormatBytes(received), readErr)
+			return nil
+		}
+	}
+	transferDuration := time.Since(transferStart)
+
+	averageBPS := float64(received) / transferDuration.Seconds()
+	if peakBPS < averageBPS {
+		peakBPS = averageBPS
+	}
+	a.InfoGroup().
+		Item("Downloaded %s in %s", united.FormatBytes(received), formatDuration(time.Since(startTime))).
+		Item("Sustained %s/s", united.FormatBytes(int64(averageBPS))).
+		Item("Peak %s/s", united.FormatBytes(int64(peakBPS))).
+		End()
+
+	if res.ContentLength >= 0 && received != res.ContentLength {
+		a.Errorf("Download was truncated: expected %s, got %s", united.FormatBytes(res.ContentLength), united.FormatBytes(received))
+		a.Errorf("Something between you and itch.io (proxy, antivirus) is cutting downloads short")
+		return nil
+	}
+
+	actualHash := hex.EncodeToString(hasher.Sum(nil))
+	if cfg.SHA256 == "" {
+		a.Infof("SHA-256 is <code>%s</code> (no expected hash configured)", actualHash)
+		if archive != nil {
+			a.VerifyDownloadedArchive(archive.Bytes())
+		}
+		return nil
+	}
+
+	if !strings.EqualFold(actualHash, cfg.SHA256) {
+		a.Errorf("Download is corrupted: SHA-256 is <code>%s</code>, expected <code>%s</code>", actualHash, cfg.SHA256)
+		a.Errorf("Something between you and itch.io (proxy, antivirus) is altering downloads")
+		return nil
+	}
+
+	a.Successf("Download is intact (SHA-256 <code>%s</code>)", actualHash)
+	return nil
+}
+
+// VerifyDownloadedArchive checks every file of a downloaded zip archive
+// against its CRC-32, which catches corruption without knowing the
+// archive's hash in advance.
+func (a *App) VerifyDownloadedArchive(data []byte) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		a.Debugf("Download is not a zip archive, so its contents can't be checked: %s", err.Error())
+		return
+	}
+
+	for _, f := range zr.File {
+		err := checkZipEntry(f)
+		if err != nil {
+			a.Errorf("Download is corrupted: <code>%s</code> in the archive is damaged (%s)", html.EscapeString(f.Name), err.Error())
+			a.Errorf("Something between you and itch.io (proxy, antivirus) is altering downloads")
+			return
+		}
+	}
+	a.Successf("Download is intact (all %d files in the archive match their checksums)", len(zr.File))
+}
+
+// checkZipEntry reads a zip entry fully, which makes archive/zip check
+// its CRC-32.
+func checkZipEntry(f *zip.File) error {
+	r, err := f.Open()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer r.Close()
+
+	_, err = io.Copy(ioutil.Discard, r)
+	return errors.WithStack(err)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func buildTestArchive(t *testing.T) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"butler.exe", "c7zip.dll"} {
+		// stored, so corrupting a byte doesn't break decompression first
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(bytes.Repeat([]byte(name), 1000))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDiagnoseDownload(t *testing.T) {
+	archive := buildTestArchive(t)
+	corrupted := append([]byte(nil), archive...)
+	// somewhere in the middle of butler.exe's contents
+	corrupted[100] ^= 0xff
+
+	sum := sha256.Sum256(archive)
+	archiveHash := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name    string
+		body    []byte
+		sha256  string
+		level   string
+		message string
+	}{
+		{"intact archive", archive, "", "success", "all 2 files in the archive match"},
+		{"corrupted archive", corrupted, "", "error", "<code>butler.exe</code> in the archive is damaged"},
+		{"not an archive", []byte("hello"), "", "debug", "not a zip archive"},
+		{"expected hash", archive, archiveHash, "success", "Download is intact (SHA-256"},
+		{"wrong hash", corrupted, archiveHash, "error", "Download is corrupted: SHA-256"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write(test.body)
+			}))
+			defer srv.Close()
+
+			a := newTestApp()
+			a.config.DownloadTest.URL = srv.URL
+			a.config.DownloadTest.SHA256 = test.sha256
+			err := a.DiagnoseDownload()
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			assertEntry(t, a.report, test.level, test.message)
+		})
+	}
+}
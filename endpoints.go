@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Endpoint purposes
+const (
+	PurposeWebsite = "website"
+	PurposeAPI     = "api"
+	PurposeCDN     = "cdn"
+	PurposeBroth   = "broth"
+	PurposeUploads = "uploads"
+)
+
+// endpointPurposes are the valid values of Endpoint.Purpose
+var endpointPurposes = []string{PurposeWebsite, PurposeAPI, PurposeCDN, PurposeBroth, PurposeUploads}
+
+// endpointSeverities are the log levels an unreachable endpoint can have
+var endpointSeverities = []string{"error", "warn", "info"}
+
+// Endpoint is a URL we probe, along with what we expect it to return
+type Endpoint struct {
+	URL     string `json:"url"`
+	Purpose string `json:"purpose"`
+
+	// ExpectedStatus is the HTTP status code we expect, or 0 for any
+	ExpectedStatus int `json:"expectedStatus,omitempty"`
+	// ExpectedBody is compared with the response body, ignoring surrounding
+	// whitespace, unless empty.
+	ExpectedBody        string `json:"expectedBody,omitempty"`
+	ExpectedContentType string `json:"expectedContentType,omitempty"`
+
+	// Severity is the log level used if the endpoint is unreachable
+	Severity string `json:"severity,omitempty"`
+}
+
+func DefaultEndpoints() []Endpoint {
+	return []Endpoint{
+		{
+			URL:                 "https://itch.io/static/ping.txt",
+			Purpose:             PurposeWebsite,
+			ExpectedStatus:      200,
+			ExpectedBody:        "pong",
+			ExpectedContentType: "text/plain",
+			Severity:            "error",
+		},
+		{
+			URL:      "https://api.itch.io/",
+			Purpose:  PurposeAPI,
+			Severity: "error",
+		},
+		{
+			URL:                 "https://static.itch.io/ping.txt",
+			Purpose:             PurposeCDN,
+			ExpectedStatus:      200,
+			ExpectedBody:        "pong",
+			ExpectedContentType: "text/plain",
+			Severity:            "error",
+		},
+		{
+			URL:            "https://broth.itch.ovh",
+			Purpose:        PurposeBroth,
+			ExpectedStatus: 200,
+			Severity:       "error",
+		},
+	}
+}
+
+// LoadEndpoints reads a JSON array of endpoints from a file
+func LoadEndpoints(path string) ([]Endpoint, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var endpoints []Endpoint
+	err = json.Unmarshal(contents, &endpoints)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while decoding %s", path)
+	}
+
+	for i := range endpoints {
+		err = endpoints[i].normalize()
+		if err != nil {
+			return nil, errors.Wrapf(err, "in %s", path)
+		}
+	}
+	return endpoints, nil
+}
+
+func (ep *Endpoint) normalize() error {
+	if ep.URL == "" {
+		return errors.Errorf("endpoint has no URL")
+	}
+	u, err := url.Parse(ep.URL)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.Errorf("%s: should be an http or https URL", ep.URL)
+	}
+
+	if ep.Purpose == "" {
+		ep.Purpose = PurposeWebsite
+	}
+	if !containsString(endpointPurposes, ep.Purpose) {
+		return errors.Errorf("%s: invalid purpose %q (should be one of %s)", ep.URL, ep.Purpose, strings.Join(endpointPurposes, ", "))
+	}
+
+	if ep.Severity == "" {
+		ep.Severity = "error"
+	}
+	if !containsString(endpointSeverities, ep.Severity) {
+		return errors.Errorf("%s: invalid severity %q (should be one of %s)", ep.URL, ep.Severity, strings.Join(endpointSeverities, ", "))
+	}
+	return nil
+}
+
+// endpointsFlag collects endpoints given on the command line,
+// as `URL` or `purpose=URL`.
+type endpointsFlag struct {
+	endpoints *[]Endpoint
+}
+
+func (ef *endpointsFlag) String() string {
+	if ef.endpoints == nil {
+		return ""
+	}
+	var urls []string
+	for _, ep := range *ef.endpoints {
+		urls = append(urls, ep.URL)
+	}
+	return strings.Join(urls, ",")
+}
+
+func (ef *endpointsFlag) Set(value string) error {
+	ep := Endpoint{URL: value}
+	if tokens := strings.SplitN(value, "=", 2); len(tokens) == 2 && !strings.Contains(tokens[0], "/") {
+		ep.Purpose = tokens[0]
+		ep.URL = tokens[1]
+	}
+	err := ep.normalize()
+	if err != nil {
+		return err
+	}
+	*ef.endpoints = append(*ef.endpoints, ep)
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDefaultEndpoints(t *testing.T) {
+	for _, ep := range DefaultEndpoints() {
+		normalized := ep
+		err := normalized.normalize()
+		if err != nil {
+			t.Errorf("%+v", err)
+		}
+		if !reflect.DeepEqual(normalized, ep) {
+			t.Errorf("default endpoint %s isn't normalized: %+v", ep.URL, ep)
+		}
+	}
+}
+
+func TestLoadEndpoints(t *testing.T) {
+	folder, err := ioutil.TempDir("", "itch-diag-endpoints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	tests := []struct {
+		name      string
+		contents  string
+		endpoints []Endpoint
+		wantErr   string
+	}{
+		{
+			name:     "defaults filled in",
+			contents: `[{"url": "http://127.0.0.1:8080/ping.txt", "expectedBody": "pong"}]`,
+			endpoints: []Endpoint{
+				{URL: "http://127.0.0.1:8080/ping.txt", Purpose: PurposeWebsite, ExpectedBody: "pong", Severity: "error"},
+			},
+		},
+		{
+			name:     "every field",
+			contents: `[{"url": "https://cdn.example.com/ping", "purpose": "cdn", "expectedStatus": 204, "expectedContentType": "text/plain", "severity": "warn"}]`,
+			endpoints: []Endpoint{
+				{URL: "https://cdn.example.com/ping", Purpose: PurposeCDN, ExpectedStatus: 204, ExpectedContentType: "text/plain", Severity: "warn"},
+			},
+		},
+		{name: "not JSON", contents: `[{"url": `, wantErr: "while decoding"},
+		{name: "no URL", contents: `[{"purpose": "api"}]`, wantErr: "endpoint has no URL"},
+		{name: "not a URL", contents: `[{"url": "itch.io"}]`, wantErr: "should be an http or https URL"},
+		{name: "typo in purpose", contents: `[{"url": "https://itch.io", "purpose": "websit"}]`, wantErr: `invalid purpose "websit"`},
+		{name: "typo in severity", contents: `[{"url": "https://itch.io", "severity": "warning"}]`, wantErr: `invalid severity "warning"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(folder, "endpoints.json")
+			err := ioutil.WriteFile(path, []byte(test.contents), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			endpoints, err := LoadEndpoints(path)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			if !reflect.DeepEqual(endpoints, test.endpoints) {
+				t.Errorf("expected %+v, got %+v", test.endpoints, endpoints)
+			}
+		})
+	}
+}
+
+func TestEndpointFlags(t *testing.T) {
+	tests := []struct {
+		args      []string
+		endpoints []Endpoint
+		wantErr   string
+	}{
+		{
+			args:      nil,
+			endpoints: DefaultEndpoints(),
+		},
+		{
+			args: []string{"-endpoint", "http://localhost:8080/ping.txt", "-endpoint", "api=http://localhost:8080/api"},
+			endpoints: []Endpoint{
+				{URL: "http://localhost:8080/ping.txt", Purpose: PurposeWebsite, Severity: "error"},
+				{URL: "http://localhost:8080/api", Purpose: PurposeAPI, Severity: "error"},
+			},
+		},
+		{
+			// a query string isn't a purpose
+			args: []string{"-endpoint", "https://example.com/ping?a=b"},
+			endpoints: []Endpoint{
+				{URL: "https://example.com/ping?a=b", Purpose: PurposeWebsite, Severity: "error"},
+			},
+		},
+		{
+			args:    []string{"-endpoint", "cnd=https://static.itch.io/ping.txt"},
+			wantErr: `invalid purpose "cnd"`,
+		},
+	}
+
+	for _, test := range tests {
+		c := DefaultConfig()
+		fs := flag.NewFlagSet("itch-diag", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		c.RegisterFlags(fs)
+
+		err := c.Parse(fs, test.args)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%v: expected an error containing %q, got %v", test.args, test.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %+v", test.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(c.Endpoints, test.endpoints) {
+			t.Errorf("%v: expected %+v, got %+v", test.args, test.endpoints, c.Endpoints)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// FS is what checks use to read files, so they can run against fixtures
+type FS interface {
+	Stat(name string) (os.FileInfo, error)
+	// ReadDir lists a folder, sorted by name. It doesn't follow symlinks.
+	ReadDir(name string) ([]os.FileInfo, error)
+	ReadFile(name string) ([]byte, error)
+	// Open opens a file for reading
+	Open(name string) (File, error)
+}
+
+// File is the subset of *os.File checks use
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+	Stat() (os.FileInfo, error)
+}
+
+// GlobFolder returns the paths of the entries of folder whose name matches
+// pattern, see filepath.Match. A missing folder has no matches.
+func GlobFolder(fsys FS, folder string, pattern string) ([]string, error) {
+	items, err := fsys.ReadDir(folder)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+
+	var matches []string
+	for _, item := range items {
+		matched, err := filepath.Match(pattern, item.Name())
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if matched {
+			matches = append(matches, filepath.Join(folder, item.Name()))
+		}
+	}
+	return matches, nil
+}
+
+// FolderStats sums up the contents of a folder
+type FolderStats struct {
+	Size     int64
+	Files    int
+	Dirs     int
+	Symlinks int
+}
+
+func (s *FolderStats) Stats() string {
+	return fmt.Sprintf("%d files, %d dirs, %d symlinks", s.Files, s.Dirs, s.Symlinks)
+}
+
+// WalkFolder counts everything in folder, recursively
+func WalkFolder(fsys FS, folder string) (*FolderStats, error) {
+	stats := &FolderStats{}
+	var walk func(folder string) error
+	walk = func(folder string) error {
+		items, err := fsys.ReadDir(folder)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		for _, item := range items {
+			switch {
+			case item.Mode()&os.ModeSymlink != 0:
+				stats.Symlinks++
+			case item.IsDir():
+				stats.Dirs++
+				err := walk(filepath.Join(folder, item.Name()))
+				if err != nil {
+					return err
+				}
+			default:
+				stats.Files++
+				stats.Size += item.Size()
+			}
+		}
+		return nil
+	}
+
+	err := walk(folder)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// osFS is the actual filesystem
+type osFS struct{}
+
+var _ FS = osFS{}
+
+func (osFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFS) ReadDir(name string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(name)
+}
+
+func (osFS) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(name)
+}
+
+func (osFS) Open(name string) (File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MemFS is an in-memory FS, to set up fixtures for checks. Errors can be
+// injected for any path, to simulate unreadable files.
+type MemFS struct {
+	mu      sync.Mutex
+	entries map[string]*memEntry
+}
+
+type memEntry struct {
+	name     string
+	contents []byte
+	mode     os.FileMode
+	err      error
+}
+
+var _ FS = (*MemFS)(nil)
+
+func NewMemFS() *MemFS {
+	return &MemFS{
+		entries: make(map[string]*memEntry),
+	}
+}
+
+// AddFolder creates a folder and its parents
+func (m *MemFS) AddFolder(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.addFolder(filepath.Clean(name))
+}
+
+func (m *MemFS) addFolder(name string) {
+	for {
+		if _, ok := m.entries[name]; !ok {
+			m.entries[name] = &memEntry{
+				name: filepath.Base(name),
+				mode: os.ModeDir | 0755,
+			}
+		}
+		parent := filepath.Dir(name)
+		if parent == name {
+			return
+		}
+		name = parent
+	}
+}
+
+// AddFile creates a file with the given contents, and its parent folders
+func (m *MemFS) AddFile(name string, contents []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	m.addFolder(filepath.Dir(name))
+	m.entries[name] = &memEntry{
+		name:     filepath.Base(name),
+		contents: contents,
+		mode:     0644,
+	}
+}
+
+// AddError makes every operation on name fail with err. If name doesn't
+// exist yet, it's listed in its parent folder as a file.
+func (m *MemFS) AddError(name string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	entry, ok := m.entries[name]
+	if !ok {
+		m.addFolder(filepath.Dir(name))
+		entry = &memEntry{
+			name: filepath.Base(name),
+			mode: 0644,
+		}
+		m.entries[name] = entry
+	}
+	entry.err = err
+}
+
+func (m *MemFS) lookup(op string, name string) (*memEntry, error) {
+	name = filepath.Clean(name)
+	entry, ok := m.entries[name]
+	if !ok {
+		return nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	if entry.err != nil {
+		return nil, &os.PathError{Op: op, Path: name, Err: entry.err}
+	}
+	return entry, nil
+}
+
+func (m *MemFS) Stat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, err := m.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return entry.info(), nil
+}
+
+func (m *MemFS) ReadDir(name string) ([]os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, err := m.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if !entry.mode.IsDir() {
+		return nil, &os.PathError{Op: "readdirent", Path: name, Err: errors.New("not a directory")}
+	}
+
+	prefix := filepath.Clean(name) + string(filepath.Separator)
+	if strings.HasSuffix(filepath.Clean(name), string(filepath.Separator)) {
+		prefix = filepath.Clean(name)
+	}
+
+	var infos []os.FileInfo
+	for path, child := range m.entries {
+		if !strings.HasPrefix(path, prefix) || path == prefix {
+			continue
+		}
+		if strings.Contains(path[len(prefix):], string(filepath.Separator)) {
+			continue
+		}
+		infos = append(infos, child.info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, err := m.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if entry.mode.IsDir() {
+		return nil, &os.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+	return append([]byte(nil), entry.contents...), nil
+}
+
+func (m *MemFS) Open(name string) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, err := m.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if entry.mode.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	}
+	return &memFile{
+		Reader: bytes.NewReader(append([]byte(nil), entry.contents...)),
+		info:   entry.info(),
+	}, nil
+}
+
+// memFile is an open MemFS file
+type memFile struct {
+	*bytes.Reader
+	info os.FileInfo
+}
+
+func (f *memFile) Close() error               { return nil }
+func (f *memFile) Stat() (os.FileInfo, error) { return f.info, nil }
+
+func (e *memEntry) info() os.FileInfo {
+	return &memFileInfo{
+		name: e.name,
+		size: int64(len(e.contents)),
+		mode: e.mode,
+	}
+}
+
+type memFileInfo struct {
+	name string
+	size int64
+	mode os.FileMode
+}
+
+func (fi *memFileInfo) Name() string       { return fi.name }
+func (fi *memFileInfo) Size() int64        { return fi.size }
+func (fi *memFileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *memFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi *memFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *memFileInfo) Sys() interface{}   { return nil }
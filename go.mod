@@ -9,17 +9,15 @@ require (
 	github.com/getlantern/mockconn v0.0.0-20190708122800-637bd46d8034 // indirect
 	github.com/golang/protobuf v1.3.2 // indirect
 	github.com/itchio/headway v0.0.0-20190702175331-a4c65c5306de
-	github.com/itchio/httpkit v0.0.0-20190703105757-f6353d320e52
 	github.com/itchio/kompress v0.0.0-20190703125833-0b2a6b182782 // indirect
-	github.com/itchio/lake v0.0.0-20190703103538-f71861a8a3eb
 	github.com/itchio/ox v0.0.0-20190705170940-1e1b8248fbc5
 	github.com/klauspost/compress v1.7.5 // indirect
 	github.com/pkg/errors v0.8.1
 	github.com/stretchr/objx v0.2.0 // indirect
 	github.com/stretchr/testify v1.4.0 // indirect
 	github.com/zserge/webview v0.0.0-20190123072648-16c93bcaeaeb
-	golang.org/x/crypto v0.0.0-20190701094942-4def268fd1a4 // indirect
-	golang.org/x/net v0.0.0-20190813141303-74dc4d7220e7 // indirect
+	golang.org/x/crypto v0.0.0-20190701094942-4def268fd1a4
+	golang.org/x/net v0.0.0-20190813141303-74dc4d7220e7
 	golang.org/x/sys v0.0.0-20190813064441-fde4db37ae7a
 	golang.org/x/tools v0.0.0-20190820033707-85edb9ef3283 // indirect
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
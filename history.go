@@ -0,0 +1,307 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxHistory is how many past reports are kept
+	maxHistory = 20
+	// maxBundledHistory is how many past reports go in a bundle
+	maxBundledHistory = 5
+	// recurringWindow is how many past runs are looked at for recurring issues
+	recurringWindow = 5
+)
+
+// historyTimeFormat is used in history file names, so they sort by date
+const historyTimeFormat = "20060102T150405Z"
+
+// HistoryFolder returns where past reports are kept, or an empty string
+// if history is disabled. It's only created if the itch data folder exists.
+func (a *App) HistoryFolder() (string, error) {
+	if !a.config.History || a.config.Snapshot != "" {
+		return "", nil
+	}
+
+	appDataFolder, err := a.GetAppDataFolder()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	if _, err := a.fs.Stat(appDataFolder); err != nil {
+		return "", nil
+	}
+	return filepath.Join(appDataFolder, "itch-diag", "history"), nil
+}
+
+// LoadHistory returns past reports, most recent first
+func (a *App) LoadHistory() ([]*Report, error) {
+	historyFolder, err := a.HistoryFolder()
+	if err != nil || historyFolder == "" {
+		return nil, errors.WithStack(err)
+	}
+
+	paths, err := historyFiles(a.fs, historyFolder)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var reports []*Report
+	for i := len(paths) - 1; i >= 0; i-- {
+		report, err := readReport(a.fs, paths[i])
+		if err != nil {
+			a.Debugf("Skipping unreadable past report <code>%s</code>: %s", filepath.Base(paths[i]), err.Error())
+			continue
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// historyFiles lists past reports, oldest first
+func historyFiles(fsys FS, historyFolder string) ([]string, error) {
+	items, err := fsys.ReadDir(historyFolder)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+
+	var paths []string
+	for _, item := range items {
+		if item.Mode().IsRegular() && strings.HasPrefix(item.Name(), "report-") && strings.HasSuffix(item.Name(), ".json") {
+			paths = append(paths, filepath.Join(historyFolder, item.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// KeepsHistory returns true if this run's report will be saved for next
+// time, which isn't the case when monitoring.
+func (a *App) KeepsHistory() bool {
+	if a.config.Monitor.Duration > 0 {
+		return false
+	}
+	historyFolder, err := a.HistoryFolder()
+	return err == nil && historyFolder != ""
+}
+
+// SaveReports asks which data categories to share, then keeps the report
+// in history and writes it to the configured outputs, both without what
+// the user withheld.
+func (a *App) SaveReports() {
+	keepsHistory := a.KeepsHistory()
+	if keepsHistory || len(a.config.Outputs) > 0 {
+		a.AskConsent()
+	}
+
+	if keepsHistory {
+		err := a.SaveToHistory()
+		if err != nil {
+			a.Warnf("Could not save this report for next time: %s", err.Error())
+		}
+	}
+	a.WriteOutputs()
+}
+
+// SaveToHistory keeps the report of this run, and forgets the oldest ones
+func (a *App) SaveToHistory() error {
+	historyFolder, err := a.HistoryFolder()
+	if err != nil || historyFolder == "" {
+		return errors.WithStack(err)
+	}
+
+	err = os.MkdirAll(historyFolder, 0755)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	name := fmt.Sprintf("report-%s.json", a.report.StartedAt.UTC().Format(historyTimeFormat))
+	f, err := os.Create(filepath.Join(historyFolder, name))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	err = a.report.WriteJSON(f)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	paths, err := historyFiles(osFS{}, historyFolder)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for len(paths) > maxHistory {
+		err = os.Remove(paths[0])
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		paths = paths[1:]
+	}
+	return nil
+}
+
+// CompareWithHistory points out checks that failed for the first time,
+// failed again, or got fixed since the previous runs.
+func (a *App) CompareWithHistory() {
+	history, err := a.LoadHistory()
+	if err != nil {
+		a.Debugf("Could not load past reports: %s", err.Error())
+		return
+	}
+	if len(history) == 0 {
+		return
+	}
+	a.Debugf("Comparing with %d past runs (the last one was %s ago)", len(history), formatAgo(a.report.StartedAt.Sub(history[0].StartedAt)))
+
+	for _, check := range a.report.Checks {
+		if check.Status == StatusSkipped {
+			continue
+		}
+
+		var previous []*CheckResult
+		var lastPassed *Report
+		for _, past := range history {
+			pastCheck := findCheck(past, check.ID)
+			if pastCheck == nil || pastCheck.Status == StatusSkipped {
+				continue
+			}
+			previous = append(previous, pastCheck)
+			if lastPassed == nil && pastCheck.Status == StatusOK {
+				lastPassed = past
+			}
+		}
+		if len(previous) == 0 {
+			continue
+		}
+
+		failing := check.Status == StatusWarn || check.Status == StatusError
+		wasFailing := previous[0].Status != StatusOK
+		switch {
+		case failing && !wasFailing:
+			a.Warnf("New issue: <i>%s</i> passed %s ago", check.Label, formatAgo(a.report.StartedAt.Sub(lastPassed.StartedAt)))
+		case failing && wasFailing:
+			window := previous
+			if len(window) > recurringWindow {
+				window = window[:recurringWindow]
+			}
+			failures := 0
+			for _, past := range window {
+				if past.Status != StatusOK {
+					failures++
+				}
+			}
+			since := "never passed in the runs we remember"
+			if lastPassed != nil {
+				since = fmt.Sprintf("last passed %s ago", formatAgo(a.report.StartedAt.Sub(lastPassed.StartedAt)))
+			}
+			a.Warnf("Recurring issue: <i>%s</i> also failed in %d of the last %d runs (%s)", check.Label, failures, len(window), since)
+		case !failing && wasFailing:
+			a.Successf("Fixed: <i>%s</i> failed last time, and passes now", check.Label)
+		}
+	}
+}
+
+// coversCategories returns true if every category of required is in list
+func coversCategories(list []string, required []string) bool {
+	for _, category := range required {
+		if !containsString(list, category) {
+			return false
+		}
+	}
+	return true
+}
+
+func findCheck(report *Report, id string) *CheckResult {
+	for _, check := range report.Checks {
+		if check.ID == id {
+			return check
+		}
+	}
+	return nil
+}
+
+// formatAgo formats how long ago something happened, roughly
+func formatAgo(d time.Duration) string {
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s", unit)
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+
+	switch {
+	case d < time.Minute:
+		return "less than a minute"
+	case d < time.Hour:
+		return plural(int(d/time.Minute), "minute")
+	case d < 48*time.Hour:
+		return plural(int(d/time.Hour), "hour")
+	default:
+		return plural(int(d/(24*time.Hour)), "day")
+	}
+}
+
+// bundledHistory returns the past reports that go in a bundle
+func (a *App) bundledHistory() ([]*Report, error) {
+	history, err := a.LoadHistory()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var reports []*Report
+	for _, past := range history {
+		// this run is already in the history
+		if past.StartedAt.Equal(a.report.StartedAt) {
+			continue
+		}
+		if len(reports) >= maxBundledHistory {
+			break
+		}
+		reports = append(reports, past)
+	}
+	return reports, nil
+}
+
+// bundleHistory adds the last few past reports to a bundle. Those were
+// saved without what the user withheld back then, so reports that kept
+// something the user withheld from this one are left out entirely.
+func (a *App) bundleHistory(zw *zip.Writer) error {
+	history, err := a.bundledHistory()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	withheld := a.report.WithheldCategories()
+	for _, past := range history {
+		if !coversCategories(past.Withheld, withheld) {
+			a.Debugf("Leaving out the report of %s, which was saved with more data than shared now", past.StartedAt.Format(time.RFC3339))
+			continue
+		}
+
+		entry, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     fmt.Sprintf("history/report-%s.json", past.StartedAt.UTC().Format(historyTimeFormat)),
+			Method:   zip.Deflate,
+			Modified: past.StartedAt,
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		err = past.WriteJSON(entry)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
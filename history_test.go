@@ -0,0 +1,112 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newHistoryTestApp(t *testing.T) (*App, func()) {
+	appDataFolder, err := ioutil.TempDir("", "itch-diag-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := newTestApp()
+	a.config.AppDataFolder = appDataFolder
+	return a, func() { os.RemoveAll(appDataFolder) }
+}
+
+func TestSaveReportsAfterConsent(t *testing.T) {
+	a, cleanup := newHistoryTestApp(t)
+	defer cleanup()
+
+	// no outputs, but the report is kept in history, so consent is needed
+	a.config.Consent = []string{CategorySystem}
+	a.report.Checks = []*CheckResult{
+		{ID: "os", Category: CategorySystem, Status: StatusOK},
+		{ID: "appdata", Category: CategoryPaths, Status: StatusOK, Values: map[string]string{"broth packages": "butler/"}},
+	}
+	a.SaveReports()
+
+	history, err := a.LoadHistory()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("expected 1 report in history, got %d", len(history))
+	}
+	if findCheck(history[0], "os") == nil {
+		t.Errorf("expected the shared check to be kept")
+	}
+	if findCheck(history[0], "appdata") != nil {
+		t.Errorf("the withheld check shouldn't be kept in history")
+	}
+	if !history[0].IsWithheld(CategoryPaths) {
+		t.Errorf("expected the kept report to say paths were withheld, got %v", history[0].Withheld)
+	}
+}
+
+func TestBundleHistoryLeavesOutBroaderReports(t *testing.T) {
+	a, cleanup := newHistoryTestApp(t)
+	defer cleanup()
+
+	historyFolder, err := a.HistoryFolder()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	err = os.MkdirAll(historyFolder, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	savePast := func(startedAt time.Time, withheld []string) string {
+		past := NewReport()
+		past.StartedAt = startedAt
+		past.Checks = []*CheckResult{
+			{ID: "appdata", Category: CategoryPaths, Status: StatusOK},
+		}
+		past.Withhold(withheld)
+
+		name := "report-" + startedAt.UTC().Format(historyTimeFormat) + ".json"
+		var buf bytes.Buffer
+		err := past.WriteJSON(&buf)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		err = ioutil.WriteFile(filepath.Join(historyFolder, name), buf.Bytes(), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "history/" + name
+	}
+	now := a.report.StartedAt
+	strict := savePast(now.Add(-2*time.Hour), []string{CategoryPaths, CategoryLogs, CategoryNetwork})
+	broad := savePast(now.Add(-1*time.Hour), []string{CategoryLogs})
+
+	a.report.Withhold([]string{CategoryPaths, CategoryLogs})
+	var bundle bytes.Buffer
+	err = a.WriteBundle(&bundle)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(bundle.Bytes()), int64(bundle.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	for _, f := range zr.File {
+		names[f.Name] = true
+	}
+	if !names[strict] {
+		t.Errorf("expected %s, saved with less data, in the bundle", strict)
+	}
+	if names[broad] {
+		t.Errorf("%s kept paths, which were withheld now, and shouldn't be bundled", broad)
+	}
+}
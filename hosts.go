@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// publicResolvers are queried to find out what itch.io's records look like
+// from outside the user's machine.
+var publicResolvers = []string{
+	"1.1.1.1:53",
+	"8.8.8.8:53",
+}
+
+func hostsFilePath() string {
+	if runtime.GOOS == "windows" {
+		systemRoot := os.Getenv("SystemRoot")
+		if systemRoot == "" {
+			systemRoot = `C:\Windows`
+		}
+		return filepath.Join(systemRoot, "System32", "drivers", "etc", "hosts")
+	}
+	return "/etc/hosts"
+}
+
+// DiagnoseHosts looks for hosts file entries that redirect or block
+// itch.io domains, then compares the system resolver's answers with
+// those of public resolvers.
+func (a *App) DiagnoseHosts() error {
+	hostsPath := hostsFilePath()
+	f, err := a.fs.Open(hostsPath)
+	if err != nil {
+		a.Warnf("Could not read hosts file: %+v", err)
+	} else {
+		defer f.Close()
+
+		overrides := 0
+		lineNumber := 0
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			lineNumber++
+			address, domains := parseHostsLine(s.Text())
+			for _, domain := range domains {
+				if !isItchPattern(domain) {
+					continue
+				}
+				overrides++
+				if address == "" {
+					// dnsmasq answers `address=/domain/` lines with NXDOMAIN
+					a.Errorf("<code>%s</code> line %d blocks <code>%s</code>", hostsPath, lineNumber, domain)
+				} else if isBlockingAddress(address) {
+					a.Errorf("<code>%s</code> line %d blocks <code>%s</code> (points it to <code>%s</code>)", hostsPath, lineNumber, domain, address)
+				} else {
+					a.Errorf("<code>%s</code> line %d redirects <code>%s</code> to <code>%s</code>", hostsPath, lineNumber, domain, address)
+				}
+			}
+		}
+		if err := s.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if overrides > 0 {
+			a.Errorf("Remove those lines from your hosts file (they're often added by ad-blocking lists or other software), then restart the itch app")
+		} else {
+			a.Infof("No itch.io overrides in <code>%s</code>", hostsPath)
+		}
+	}
+
+	seenHosts := make(map[string]bool)
+	for _, ep := range a.config.Endpoints {
+		host := hostOf(ep.URL)
+		if host == "" || seenHosts[host] || net.ParseIP(host) != nil {
+			continue
+		}
+		seenHosts[host] = true
+		a.CompareResolvers(host)
+	}
+
+	return nil
+}
+
+// parseHostsLine returns the address and domains of a hosts file line.
+// It also understands dnsmasq-style `address=/domain/ip` lines.
+func parseHostsLine(line string) (string, []string) {
+	if i := strings.Index(line, "#"); i >= 0 {
+		line = line[:i]
+	}
+	line = strings.TrimSpace(line)
+
+	if strings.HasPrefix(line, "address=/") {
+		tokens := strings.Split(strings.TrimPrefix(line, "address="), "/")
+		// "/domain/.../ip" splits into "", "domain", ..., "ip"
+		if len(tokens) < 3 {
+			return "", nil
+		}
+		return tokens[len(tokens)-1], tokens[1 : len(tokens)-1]
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return "", nil
+	}
+	return fields[0], fields[1:]
+}
+
+// isItchPattern returns true if a hosts-like pattern would match an itch.io
+// domain, including wildcard-style `*.itch.io` and `.itch.io` entries.
+func isItchPattern(pattern string) bool {
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+	pattern = strings.TrimPrefix(pattern, "*")
+	pattern = strings.TrimPrefix(pattern, ".")
+	return isItchHost(pattern)
+}
+
+func isBlockingAddress(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	return ip.IsLoopback() || ip.IsUnspecified()
+}
+
+// CompareResolvers resolves host with the system resolver and with
+// public resolvers, and flags suspicious differences.
+func (a *App) CompareResolvers(host string) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.config.Timeouts.Connect)
+	defer cancel()
+
+	systemAddrs, systemErr := net.DefaultResolver.LookupHost(ctx, host)
+
+	var publicAddrs []string
+	var publicErr error
+	for _, server := range publicResolvers {
+		publicAddrs, publicErr = newPublicResolver(server).LookupHost(ctx, host)
+		if publicErr == nil {
+			break
+		}
+	}
+
+	if publicErr != nil {
+		a.Debugf("Could not query public resolvers for <code>%s</code>: %s", host, publicErr.Error())
+	}
+
+	switch {
+	case systemErr != nil && publicErr == nil:
+		a.Errorf("<code>%s</code> can't be resolved by your system (%s), but public resolvers say it's <code>%s</code>", host, systemErr.Error(), strings.Join(publicAddrs, ", "))
+		return
+	case systemErr != nil:
+		a.Errorf("<code>%s</code> can't be resolved: %s", host, systemErr.Error())
+		return
+	}
+
+	if addr := findNonPublicAddress(host, systemAddrs); addr != "" {
+		a.Errorf("Your system resolves <code>%s</code> to <code>%s</code>, which is not a public address: something is blocking or redirecting it", host, addr)
+		return
+	}
+
+	if publicErr != nil {
+		a.Infof("<code>%s</code> resolves to <code>%s</code>", host, strings.Join(systemAddrs, ", "))
+		return
+	}
+
+	if sameAddresses(systemAddrs, publicAddrs) {
+		a.Infof("<code>%s</code> resolves to <code>%s</code>, like with public resolvers", host, strings.Join(systemAddrs, ", "))
+		return
+	}
+
+	// CDNs routinely give different answers depending on who's asking,
+	// so this alone is not a problem.
+	a.Infof("<code>%s</code> resolves to <code>%s</code> (public resolvers say <code>%s</code>)", host, strings.Join(systemAddrs, ", "), strings.Join(publicAddrs, ", "))
+}
+
+// findNonPublicAddress returns the first loopback, unspecified or private
+// address among addrs if host is an itch.io host, which should never resolve
+// to those. Custom endpoints may legitimately live on the local network.
+func findNonPublicAddress(host string, addrs []string) string {
+	if !isItchHost(strings.ToLower(host)) {
+		return ""
+	}
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip != nil && (isBlockingAddress(addr) || isPrivateIP(ip)) {
+			return addr
+		}
+	}
+	return ""
+}
+
+func newPublicResolver(server string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialer := &net.Dialer{}
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+}
+
+var privateNets = []string{
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"169.254.0.0/16",
+	"fc00::/7",
+	"fe80::/10",
+}
+
+func isPrivateIP(ip net.IP) bool {
+	for _, cidr := range privateNets {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err == nil && ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameAddresses(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
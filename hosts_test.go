@@ -0,0 +1,143 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseHostsLine(t *testing.T) {
+	tests := []struct {
+		name        string
+		line        string
+		wantAddress string
+		wantDomains []string
+		wantItch    []bool
+	}{
+		{name: "empty", line: ""},
+		{name: "comment", line: "# 127.0.0.1 itch.io"},
+		{name: "indented comment", line: "   #0.0.0.0 itch.io"},
+		{name: "address only", line: "127.0.0.1"},
+		{
+			name:        "block",
+			line:        "0.0.0.0 itch.io",
+			wantAddress: "0.0.0.0",
+			wantDomains: []string{"itch.io"},
+			wantItch:    []bool{true},
+		},
+		{
+			name:        "inline comment",
+			line:        "127.0.0.1\tapi.itch.io # added by an ad blocker",
+			wantAddress: "127.0.0.1",
+			wantDomains: []string{"api.itch.io"},
+			wantItch:    []bool{true},
+		},
+		{
+			name:        "several domains",
+			line:        "127.0.0.1 localhost example.com img.itch.zone",
+			wantAddress: "127.0.0.1",
+			wantDomains: []string{"localhost", "example.com", "img.itch.zone"},
+			wantItch:    []bool{false, false, true},
+		},
+		{
+			name:        "wildcards",
+			line:        "0.0.0.0 *.itch.io .itch.zone ITCH.OVH.",
+			wantAddress: "0.0.0.0",
+			wantDomains: []string{"*.itch.io", ".itch.zone", "ITCH.OVH."},
+			wantItch:    []bool{true, true, true},
+		},
+		{
+			name:        "ad-block list",
+			line:        "0.0.0.0 ads.example.com tracker.itch.io.example.com notitch.io",
+			wantAddress: "0.0.0.0",
+			wantDomains: []string{"ads.example.com", "tracker.itch.io.example.com", "notitch.io"},
+			wantItch:    []bool{false, false, false},
+		},
+		{
+			name:        "ipv6",
+			line:        "::1 itch.io ip6-localhost",
+			wantAddress: "::1",
+			wantDomains: []string{"itch.io", "ip6-localhost"},
+			wantItch:    []bool{true, false},
+		},
+		{
+			name:        "dnsmasq",
+			line:        "address=/itch.io/0.0.0.0 # block",
+			wantAddress: "0.0.0.0",
+			wantDomains: []string{"itch.io"},
+			wantItch:    []bool{true},
+		},
+		{
+			name:        "dnsmasq ipv6",
+			line:        "address=/.itch.zone/::",
+			wantAddress: "::",
+			wantDomains: []string{".itch.zone"},
+			wantItch:    []bool{true},
+		},
+		{
+			name:        "dnsmasq without address",
+			line:        "address=/itch.io/",
+			wantDomains: []string{"itch.io"},
+			wantItch:    []bool{true},
+		},
+		{
+			name:        "dnsmasq with several domains",
+			line:        "address=/example.com/itch.zone/0.0.0.0",
+			wantAddress: "0.0.0.0",
+			wantDomains: []string{"example.com", "itch.zone"},
+			wantItch:    []bool{false, true},
+		},
+		{name: "dnsmasq without domain", line: "address=/0.0.0.0"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			address, domains := parseHostsLine(test.line)
+			if test.wantDomains == nil && len(domains) == 0 {
+				return
+			}
+			if address != test.wantAddress || !reflect.DeepEqual(domains, test.wantDomains) {
+				t.Fatalf("parseHostsLine(%q) = %q, %q, want %q, %q", test.line, address, domains, test.wantAddress, test.wantDomains)
+			}
+			for i, domain := range domains {
+				if got := isItchPattern(domain); got != test.wantItch[i] {
+					t.Errorf("isItchPattern(%q) = %v, want %v", domain, got, test.wantItch[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFindNonPublicAddress(t *testing.T) {
+	tests := []struct {
+		host  string
+		addrs []string
+		want  string
+	}{
+		{"itch.io", []string{"104.26.2.149", "172.67.70.119"}, ""},
+		{"itch.io", []string{"104.26.2.149", "127.0.0.1"}, "127.0.0.1"},
+		{"itch.io", []string{"0.0.0.0"}, "0.0.0.0"},
+		{"api.itch.io", []string{"::1"}, "::1"},
+		{"img.itch.zone", []string{"192.168.1.10"}, "192.168.1.10"},
+		{"Broth.Itch.Ovh", []string{"10.0.0.1"}, "10.0.0.1"},
+		// custom endpoints may be local
+		{"localhost", []string{"127.0.0.1", "::1"}, ""},
+		{"mirror.lan", []string{"192.168.1.10"}, ""},
+	}
+
+	for _, test := range tests {
+		if got := findNonPublicAddress(test.host, test.addrs); got != test.want {
+			t.Errorf("findNonPublicAddress(%q, %v) = %q, want %q", test.host, test.addrs, got, test.want)
+		}
+	}
+}
+
+func TestCompareResolversLocalEndpoint(t *testing.T) {
+	a := newTestApp()
+	// public resolvers may not be reachable from here, which is fine
+	a.config.Timeouts.Connect = 500 * time.Millisecond
+
+	a.CompareResolvers("localhost")
+	assertNoEntry(t, a.report, "error", "")
+	assertEntry(t, a.report, "info", "<code>localhost</code> resolves to")
+}
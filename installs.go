@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Installation is a copy of the itch app found on disk
+type Installation struct {
+	Kind    string
+	Path    string
+	Version string
+	// AppName is "itch" or "kitch" (the canary), which decides what
+	// data folder the install uses
+	AppName string
+}
+
+// InstallHandler is something that launches the itch app, like
+// the itch:// protocol handler or a desktop entry.
+type InstallHandler struct {
+	Label  string
+	Target string
+}
+
+func (a *App) DiagnoseInstallations() error {
+	installs, err := a.FindInstallations()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if len(installs) == 0 {
+		a.Warnf("No itch installation found")
+	}
+
+	for _, install := range installs {
+		version := install.Version
+		if version == "" {
+			version = "unknown version"
+		}
+		a.InfoGroup().
+			Item("Found %s", install.Kind).
+			Item("<code>%s</code>", install.Path).
+			Item("<code>%s</code>", version).
+			End()
+	}
+
+	handlers, err := a.FindInstallHandlers()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, handler := range handlers {
+		owner := findHandlerOwner(installs, handler)
+		if owner == nil {
+			a.Warnf("%s points to <code>%s</code>, which doesn't belong to any known install", handler.Label, handler.Target)
+			continue
+		}
+		a.Infof("%s is owned by %s (<code>%s</code>)", handler.Label, owner.Kind, owner.Path)
+	}
+
+	// itch and kitch have separate data folders, so they only fight over
+	// butler.db with installs of the same app
+	var appNames []string
+	byAppName := make(map[string][]Installation)
+	for _, install := range installs {
+		if _, ok := byAppName[install.AppName]; !ok {
+			appNames = append(appNames, install.AppName)
+		}
+		byAppName[install.AppName] = append(byAppName[install.AppName], install)
+	}
+
+	for _, appName := range appNames {
+		group := byAppName[appName]
+		if len(group) < 2 {
+			continue
+		}
+
+		appDataFolder, err := a.GetAppDataFolder()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if appName != "itch" {
+			appDataFolder = filepath.Join(filepath.Dir(appDataFolder), appName)
+		}
+		dbPath := filepath.Join(appDataFolder, "db", "butler.db")
+
+		a.Errorf("Found %d %s installations!", len(group), appName)
+		a.Errorf("They all share <code>%s</code>, and will fight over it. Uninstalling all but one is recommended.", dbPath)
+	}
+
+	return nil
+}
+
+// findHandlerOwner returns the install a handler's command launches, if any
+func findHandlerOwner(installs []Installation, handler InstallHandler) *Installation {
+	args := splitCommandLine(handler.Target)
+	if len(args) == 0 {
+		return nil
+	}
+
+	if isFlatpakRun(args) {
+		for i, install := range installs {
+			if install.Kind == "Flatpak" {
+				return &installs[i]
+			}
+		}
+		return nil
+	}
+
+	executable := normalizeInstallPath(args[0])
+	for i, install := range installs {
+		installPath := normalizeInstallPath(install.Path)
+		if executable == installPath || strings.HasPrefix(executable, installPath+string(filepath.Separator)) {
+			return &installs[i]
+		}
+	}
+	return nil
+}
+
+// isFlatpakRun returns true for commands like `flatpak run io.itch.itch %u`
+func isFlatpakRun(args []string) bool {
+	if filepath.Base(args[0]) != "flatpak" || len(args) < 2 || args[1] != "run" {
+		return false
+	}
+	for _, arg := range args[2:] {
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+		// the first non-option argument is the app ID
+		return arg == "io.itch.itch"
+	}
+	return false
+}
+
+// splitCommandLine splits a handler command into arguments, honoring
+// double quotes, and skips any leading `env VAR=value` prefix.
+func splitCommandLine(command string) []string {
+	var args []string
+	var current strings.Builder
+	inQuotes, inArg := false, false
+	for _, c := range command {
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+			inArg = true
+		case (c == ' ' || c == '\t') && !inQuotes:
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	if len(args) > 0 && filepath.Base(args[0]) == "env" {
+		args = args[1:]
+		for len(args) > 0 && strings.Contains(args[0], "=") {
+			args = args[1:]
+		}
+	}
+	return args
+}
+
+func normalizeInstallPath(path string) string {
+	path = filepath.Clean(path)
+	if runtime.GOOS == "windows" {
+		path = strings.ToLower(path)
+	}
+	return path
+}
+
+// readInstallStateVersion returns the current version of an itch-setup
+// style install folder, according to its state.json file.
+func readInstallStateVersion(fsys FS, installFolder string) (string, error) {
+	contents, err := fsys.ReadFile(filepath.Join(installFolder, "state.json"))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	var installState InstallState
+	err = json.Unmarshal(contents, &installState)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	if installState.Ready != "" {
+		return fmt.Sprintf("%s (%s ready)", installState.Current, installState.Ready), nil
+	}
+	return installState.Current, nil
+}
+
+// readPackageVersion returns the version of an unpacked electron app,
+// according to its resources/app/package.json file.
+func readPackageVersion(fsys FS, resourcesFolder string) (string, error) {
+	contents, err := fsys.ReadFile(filepath.Join(resourcesFolder, "app", "package.json"))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	var pkg struct {
+		Version string `json:"version"`
+	}
+	err = json.Unmarshal(contents, &pkg)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return pkg.Version, nil
+}
@@ -0,0 +1,48 @@
+//+build darwin
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var bundleVersionRegexp = regexp.MustCompile(`<key>CFBundleShortVersionString</key>\s*<string>([^<]*)</string>`)
+
+func (a *App) FindInstallations() ([]Installation, error) {
+	homePath := os.Getenv("HOME")
+	var installs []Installation
+
+	for _, base := range []string{"/Applications", filepath.Join(homePath, "Applications")} {
+		for _, name := range []string{"itch.app", "kitch.app"} {
+			bundle := filepath.Join(base, name)
+			if a.EnsureFolder(bundle) != nil {
+				continue
+			}
+
+			var version string
+			plist, err := a.fs.ReadFile(filepath.Join(bundle, "Contents", "Info.plist"))
+			if err == nil {
+				if matches := bundleVersionRegexp.FindSubmatch(plist); matches != nil {
+					version = string(matches[1])
+				}
+			}
+
+			installs = append(installs, Installation{
+				Kind:    "app bundle",
+				Path:    bundle,
+				Version: version,
+				AppName: strings.TrimSuffix(name, ".app"),
+			})
+		}
+	}
+
+	return installs, nil
+}
+
+func (a *App) FindInstallHandlers() ([]InstallHandler, error) {
+	a.Debugf("Looking up the <code>itch://</code> handler is not supported on macOS yet")
+	return nil, nil
+}
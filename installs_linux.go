@@ -0,0 +1,183 @@
+//+build linux
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var appImageVersionRegexp = regexp.MustCompile(`\d+\.\d+\.\d+`)
+
+func (a *App) FindInstallations() ([]Installation, error) {
+	homePath := os.Getenv("HOME")
+	var installs []Installation
+
+	for _, name := range []string{".itch", ".kitch"} {
+		folder := filepath.Join(homePath, name)
+		if a.EnsureFile(filepath.Join(folder, "state.json")) != nil {
+			continue
+		}
+		version, err := readInstallStateVersion(a.fs, folder)
+		if err != nil {
+			a.Warnf("While reading <code>%s</code> install state: %+v", folder, err)
+		}
+		installs = append(installs, Installation{
+			Kind:    "itch-setup install",
+			Path:    folder,
+			Version: version,
+			AppName: strings.TrimPrefix(name, "."),
+		})
+	}
+
+	// distribution packages, AUR, and pre-itch-setup tarballs
+	systemFolders := []string{
+		"/usr/lib/itch",
+		"/usr/share/itch",
+		"/usr/local/lib/itch",
+		"/usr/local/share/itch",
+		"/opt/itch",
+	}
+	for _, folder := range systemFolders {
+		if a.EnsureFolder(folder) != nil {
+			continue
+		}
+		version, _ := readPackageVersion(a.fs, filepath.Join(folder, "resources"))
+		installs = append(installs, Installation{
+			Kind:    "system package",
+			Path:    folder,
+			Version: version,
+			AppName: "itch",
+		})
+	}
+
+	appImageFolders := []string{
+		filepath.Join(homePath, "Applications"),
+		filepath.Join(homePath, "Downloads"),
+		filepath.Join(homePath, ".local", "bin"),
+		filepath.Join(homePath, "bin"),
+	}
+	for _, folder := range appImageFolders {
+		matches, _ := GlobFolder(a.fs, folder, "*")
+		for _, match := range matches {
+			name := strings.ToLower(filepath.Base(match))
+			if !strings.HasPrefix(name, "itch") || !strings.HasSuffix(name, ".appimage") {
+				continue
+			}
+			installs = append(installs, Installation{
+				Kind:    "AppImage",
+				Path:    match,
+				Version: appImageVersionRegexp.FindString(name),
+				AppName: "itch",
+			})
+		}
+	}
+
+	flatpakFolders := []string{
+		"/var/lib/flatpak/app/io.itch.itch",
+		filepath.Join(homePath, ".local", "share", "flatpak", "app", "io.itch.itch"),
+	}
+	for _, folder := range flatpakFolders {
+		if a.EnsureFolder(folder) != nil {
+			continue
+		}
+		installs = append(installs, Installation{
+			Kind:    "Flatpak",
+			Path:    folder,
+			AppName: "itch",
+		})
+	}
+
+	return installs, nil
+}
+
+var desktopEntryFolders = []string{
+	filepath.Join(os.Getenv("HOME"), ".local", "share", "applications"),
+	"/usr/local/share/applications",
+	"/usr/share/applications",
+	"/var/lib/flatpak/exports/share/applications",
+	filepath.Join(os.Getenv("HOME"), ".local", "share", "flatpak", "exports", "share", "applications"),
+}
+
+func (a *App) FindInstallHandlers() ([]InstallHandler, error) {
+	var handlers []InstallHandler
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.config.Timeouts.Process)
+	defer cancel()
+	out, err := a.runner.Command(ctx, "xdg-mime", "query", "default", "x-scheme-handler/itch").Output()
+	if err != nil {
+		a.Warnf("Could not query <code>itch://</code> handler: %+v", err)
+	} else {
+		entryName := strings.TrimSpace(string(out))
+		if entryName == "" {
+			a.Warnf("No <code>itch://</code> handler registered")
+		} else {
+			handler := InstallHandler{
+				Label:  "<code>itch://</code> handler",
+				Target: entryName,
+			}
+			for _, folder := range desktopEntryFolders {
+				command, err := readDesktopEntryExec(a.fs, filepath.Join(folder, entryName))
+				if err == nil {
+					handler.Target = command
+					break
+				}
+			}
+			handlers = append(handlers, handler)
+		}
+	}
+
+	for _, folder := range desktopEntryFolders {
+		matches, _ := GlobFolder(a.fs, folder, "*.desktop")
+		for _, match := range matches {
+			if !isItchDesktopEntry(filepath.Base(match)) {
+				continue
+			}
+			command, err := readDesktopEntryExec(a.fs, match)
+			if err != nil {
+				continue
+			}
+			handlers = append(handlers, InstallHandler{
+				Label:  "Desktop entry <code>" + match + "</code>",
+				Target: command,
+			})
+		}
+	}
+
+	return handlers, nil
+}
+
+// isItchDesktopEntry returns true for desktop entries installed by the
+// itch app, itch-setup, or the Flatpak, and not for, say, "switch.desktop"
+func isItchDesktopEntry(name string) bool {
+	switch {
+	case name == "itch.desktop", name == "kitch.desktop":
+		return true
+	case strings.HasPrefix(name, "io.itch.itch") && strings.HasSuffix(name, ".desktop"):
+		return true
+	}
+	return false
+}
+
+func readDesktopEntryExec(fsys FS, entryPath string) (string, error) {
+	f, err := fsys.Open(entryPath)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(line, "Exec=") {
+			return strings.TrimPrefix(line, "Exec="), nil
+		}
+	}
+	return "", errors.Errorf("%s: no Exec line", entryPath)
+}
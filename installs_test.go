@@ -0,0 +1,41 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFindHandlerOwner(t *testing.T) {
+	itchPath := filepath.Join(string(filepath.Separator)+"home", "amos", ".itch")
+	kitchPath := filepath.Join(string(filepath.Separator)+"home", "amos", ".kitch")
+	installs := []Installation{
+		{Kind: "itch-setup install", Path: itchPath, AppName: "itch"},
+		{Kind: "itch-setup install", Path: kitchPath, AppName: "kitch"},
+		{Kind: "Flatpak", Path: "/var/lib/flatpak/app/io.itch.itch", AppName: "itch"},
+	}
+
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{`"` + filepath.Join(itchPath, "itch") + `" %u`, itchPath},
+		{filepath.Join(kitchPath, "kitch") + " %u", kitchPath},
+		{`env DESKTOPINTEGRATION=1 ` + filepath.Join(kitchPath, "kitch") + ` %u`, kitchPath},
+		{"/usr/bin/flatpak run --branch=stable --arch=x86_64 --command=itch io.itch.itch %u", "/var/lib/flatpak/app/io.itch.itch"},
+		{"flatpak run org.example.NotItch %u", ""},
+		// sharing a prefix isn't enough
+		{filepath.Join(itchPath+"-old", "itch"), ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		owner := findHandlerOwner(installs, InstallHandler{Target: test.command})
+		got := ""
+		if owner != nil {
+			got = owner.Path
+		}
+		if got != test.want {
+			t.Errorf("findHandlerOwner(%q) = %q, want %q", test.command, got, test.want)
+		}
+	}
+}
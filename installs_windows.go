@@ -0,0 +1,105 @@
+//+build windows
+
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/itchio/ox/winox"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows/registry"
+)
+
+func (a *App) FindInstallations() ([]Installation, error) {
+	localAppData, err := winox.GetFolderPath(winox.FolderTypeLocalAppData)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var installs []Installation
+	seen := make(map[string]bool)
+	addInstall := func(install Installation) {
+		key := normalizeInstallPath(install.Path)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		installs = append(installs, install)
+	}
+
+	for _, name := range []string{"itch", "kitch"} {
+		folder := filepath.Join(localAppData, name)
+		if a.EnsureFolder(folder) != nil {
+			continue
+		}
+
+		if a.EnsureFile(filepath.Join(folder, "state.json")) == nil {
+			version, err := readInstallStateVersion(a.fs, folder)
+			if err != nil {
+				a.Warnf("While reading <code>%s</code> install state: %+v", folder, err)
+			}
+			addInstall(Installation{
+				Kind:    "itch-setup install",
+				Path:    folder,
+				Version: version,
+				AppName: name,
+			})
+			continue
+		}
+
+		if a.EnsureFile(filepath.Join(folder, "Update.exe")) == nil {
+			// pre-itch-setup installs were managed by Squirrel.Windows
+			addInstall(Installation{
+				Kind:    "legacy Squirrel install",
+				Path:    folder,
+				AppName: name,
+			})
+		}
+	}
+
+	for _, name := range []string{"itch", "kitch"} {
+		k, err := registry.OpenKey(registry.CURRENT_USER, uninstallRegPrefix+"\\"+name, registry.READ)
+		if err != nil {
+			continue
+		}
+		installFolder, _, err := k.GetStringValue("InstallLocation")
+		version, _, _ := k.GetStringValue("DisplayVersion")
+		k.Close()
+		if err != nil {
+			continue
+		}
+
+		addInstall(Installation{
+			Kind:    "registered install",
+			Path:    installFolder,
+			Version: version,
+			AppName: name,
+		})
+	}
+
+	return installs, nil
+}
+
+const itchProtocolRegPath = "Software\\Classes\\itch\\shell\\open\\command"
+
+func (a *App) FindInstallHandlers() ([]InstallHandler, error) {
+	k, err := registry.OpenKey(registry.CURRENT_USER, itchProtocolRegPath, registry.READ)
+	if err != nil {
+		a.Warnf("No <code>itch://</code> handler registered")
+		return nil, nil
+	}
+	defer k.Close()
+
+	command, _, err := k.GetStringValue("")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	handlers := []InstallHandler{
+		{
+			Label:  "<code>itch://</code> handler",
+			Target: command,
+		},
+	}
+	return handlers, nil
+}
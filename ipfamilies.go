@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// IPFamilyResult is what we learned by reaching a host over a single
+// address family.
+type IPFamilyResult struct {
+	Family      string
+	Addresses   []net.IP
+	ResolveErr  error
+	ConnectedTo string
+	ConnectTime time.Duration
+	ConnectErr  error
+	// TimedOut is set if connecting stalled, rather than failing right
+	// away like it does on a host without IPv6 connectivity
+	TimedOut bool
+}
+
+func (r *IPFamilyResult) Reachable() bool {
+	return r.ConnectedTo != ""
+}
+
+// TestIPFamilies resolves A and AAAA records for host separately, then
+// tries to connect over IPv4 and IPv6 independently.
+func (a *App) TestIPFamilies(host string, port string) {
+	v4 := probeIPFamily(host, port, "4", a.config.Timeouts.Connect)
+	v6 := probeIPFamily(host, port, "6", a.config.Timeouts.Connect)
+
+	for _, r := range []*IPFamilyResult{v4, v6} {
+		lg := a.InfoGroup().Item("<code>%s</code> over IPv%s", host, r.Family)
+		switch {
+		case r.ResolveErr != nil:
+			lg.Item("could not resolve: %s", r.ResolveErr.Error())
+		case len(r.Addresses) == 0:
+			lg.Item("no records")
+		default:
+			lg.Item("resolved to <code>%s</code>", joinIPs(r.Addresses))
+			if r.Reachable() {
+				lg.Item("connected to <code>%s</code> in %s", r.ConnectedTo, formatDuration(r.ConnectTime))
+			} else {
+				lg.Item("could not connect: %s", r.ConnectErr.Error())
+			}
+		}
+		lg.End()
+	}
+
+	a.logIPFamilyFinding(host, v4, v6, hasGlobalIPv6())
+}
+
+// logIPFamilyFinding points out broken routes. A failed IPv6 connection
+// is only a problem if it stalls, or if this machine looks like it has
+// IPv6 connectivity: otherwise, it fails right away and IPv4 is used.
+func (a *App) logIPFamilyFinding(host string, v4 *IPFamilyResult, v6 *IPFamilyResult, globalIPv6 bool) {
+	hasV6 := len(v6.Addresses) > 0
+	switch {
+	case !v4.Reachable() && !v6.Reachable():
+		a.Errorf("<code>%s</code> is unreachable over both IPv4 and IPv6", host)
+	case hasV6 && !v6.Reachable() && v4.Reachable() && (v6.TimedOut || globalIPv6):
+		a.Warnf("IPv6 route to <code>%s</code> is broken: connections will stall until they fall back to IPv4, which makes the itch app slow to start", host)
+	case hasV6 && !v6.Reachable() && v4.Reachable():
+		a.Infof("No IPv6 connectivity to <code>%s</code>, IPv4 is used instead", host)
+	case len(v4.Addresses) > 0 && !v4.Reachable() && v6.Reachable():
+		a.Warnf("IPv4 route to <code>%s</code> is broken, only IPv6 works", host)
+	}
+}
+
+// hasGlobalIPv6 returns true if one of this machine's interfaces has a
+// global IPv6 address, ie. not a link-local or unique local one.
+func hasGlobalIPv6() bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.To4() != nil {
+			continue
+		}
+		// fc00::/7 is for unique local addresses
+		if ipNet.IP.IsGlobalUnicast() && ipNet.IP[0]&0xfe != 0xfc {
+			return true
+		}
+	}
+	return false
+}
+
+func probeIPFamily(host string, port string, family string, timeout time.Duration) *IPFamilyResult {
+	r := &IPFamilyResult{Family: family}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIP(ctx, "ip"+family, host)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			// no records for that family is not an error
+			return r
+		}
+		r.ResolveErr = err
+		return r
+	}
+	r.Addresses = addrs
+
+	// all addresses share the timeout, so hosts with many records don't
+	// take that much longer
+	dialCtx, dialCancel := context.WithTimeout(context.Background(), timeout)
+	defer dialCancel()
+	dialer := &net.Dialer{}
+	var errs []string
+	for _, addr := range addrs {
+		startTime := time.Now()
+		conn, err := dialer.DialContext(dialCtx, "tcp"+family, net.JoinHostPort(addr.String(), port))
+		if err != nil {
+			if netErr, ok := err.(net.Error); (ok && netErr.Timeout()) || dialCtx.Err() != nil {
+				r.TimedOut = true
+			}
+			errs = append(errs, err.Error())
+			if dialCtx.Err() != nil {
+				break
+			}
+			continue
+		}
+		r.ConnectTime = time.Since(startTime)
+		r.ConnectedTo = conn.RemoteAddr().String()
+		conn.Close()
+		return r
+	}
+	r.ConnectErr = errors.New(strings.Join(errs, "; "))
+	return r
+}
+
+func joinIPs(ips []net.IP) string {
+	var s []string
+	for _, ip := range ips {
+		s = append(s, ip.String())
+	}
+	return strings.Join(s, ", ")
+}
+
+// endpointHostPort returns the host and port an endpoint URL connects to
+func endpointHostPort(endpoint string) (string, string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", "", errors.WithStack(err)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	return u.Hostname(), port, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLogIPFamilyFinding(t *testing.T) {
+	v4 := &IPFamilyResult{Family: "4", Addresses: []net.IP{net.ParseIP("192.0.2.1")}, ConnectedTo: "192.0.2.1:443"}
+	v4Broken := &IPFamilyResult{Family: "4", Addresses: []net.IP{net.ParseIP("192.0.2.1")}, ConnectErr: errors.New("connection refused")}
+	v6 := &IPFamilyResult{Family: "6", Addresses: []net.IP{net.ParseIP("2001:db8::1")}, ConnectedTo: "[2001:db8::1]:443"}
+	v6Unreachable := &IPFamilyResult{Family: "6", Addresses: []net.IP{net.ParseIP("2001:db8::1")}, ConnectErr: errors.New("network is unreachable")}
+	v6Stalled := &IPFamilyResult{Family: "6", Addresses: []net.IP{net.ParseIP("2001:db8::1")}, ConnectErr: errors.New("i/o timeout"), TimedOut: true}
+	v6None := &IPFamilyResult{Family: "6"}
+
+	tests := []struct {
+		name       string
+		v4         *IPFamilyResult
+		v6         *IPFamilyResult
+		globalIPv6 bool
+		level      string
+		message    string
+	}{
+		{"both work", v4, v6, true, "", ""},
+		{"no AAAA records", v4, v6None, false, "", ""},
+		{"IPv4-only machine", v4, v6Unreachable, false, "info", "No IPv6 connectivity"},
+		{"IPv6 stalls", v4, v6Stalled, false, "warn", "IPv6 route to <code>itch.io</code> is broken"},
+		{"IPv6 fails with a global address", v4, v6Unreachable, true, "warn", "IPv6 route to <code>itch.io</code> is broken"},
+		{"only IPv6 works", v4Broken, v6, true, "warn", "IPv4 route to <code>itch.io</code> is broken"},
+		{"nothing works", v4Broken, v6Stalled, true, "error", "unreachable over both"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := newTestApp()
+			a.logIPFamilyFinding("itch.io", test.v4, test.v6, test.globalIPv6)
+			if test.level == "" {
+				for _, level := range []string{"info", "warn", "error"} {
+					assertNoEntry(t, a.report, level, "itch.io")
+				}
+				return
+			}
+			assertEntry(t, a.report, test.level, test.message)
+		})
+	}
+}
+
+func TestProbeIPFamilyLoopback(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	r := probeIPFamily("127.0.0.1", port, "4", time.Second)
+	if !r.Reachable() || r.TimedOut {
+		t.Errorf("expected a local listener to be reachable, got %+v", r)
+	}
+}
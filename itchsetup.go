@@ -0,0 +1,41 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// DiagnoseItchSetup verifies the itch-setup broth package, which is
+// responsible for installing and self-updating the itch app.
+func (a *App) DiagnoseItchSetup() error {
+	appDataFolder, err := a.GetAppDataFolder()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	brothFolder := filepath.Join(appDataFolder, "broth")
+	err = a.EnsureFolder(brothFolder)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	itchSetupExecutable, err := a.DiagnoseBrothPackage(brothFolder, "itch-setup")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if a.config.Snapshot != "" {
+		a.Debugf("Not running itch-setup from a snapshot")
+		return nil
+	}
+
+	itchSetupVersion, err := a.RetrieveVersion(itchSetupExecutable, "--version")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	a.Infof("itch-setup version: <code>%s</code>", itchSetupVersion)
+	a.RecordValue("itch-setup version", itchSetupVersion)
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestDiagnoseItchSetupSnapshot(t *testing.T) {
+	appDataFolder := filepath.Join(string(filepath.Separator)+"snapshot", "itch")
+	fs := NewMemFS()
+	addBrothPackage(fs, appDataFolder, "itch-setup", "1.26.0")
+	runner := NewFakeRunner()
+
+	a := newTestApp()
+	a.fs, a.runner = fs, runner
+	a.config.AppDataFolder = appDataFolder
+	a.config.Snapshot = appDataFolder
+
+	for _, check := range a.Checks() {
+		if check.ID == "itch-setup" && !a.config.ShouldRun(check) {
+			t.Errorf("itch-setup should run against snapshots")
+		}
+	}
+
+	err := a.DiagnoseItchSetup()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	assertEntry(t, a.report, "info", "itch-setup chosen version: <code>1.26.0</code>")
+	if len(runner.Calls) > 0 {
+		t.Errorf("nothing should run from a snapshot, but ran %v", runner.Calls)
+	}
+}
+
+func TestDiagnoseItchSetup(t *testing.T) {
+	appDataFolder := filepath.Join(string(filepath.Separator)+"fixture", "itch")
+	packageFolder := filepath.Join(appDataFolder, "broth", "itch-setup")
+
+	tests := []struct {
+		name    string
+		setup   func(a *App, fs *MemFS, runner *FakeRunner, executable string)
+		wantErr string
+		want    string
+	}{
+		{
+			name: "healthy",
+			setup: func(a *App, fs *MemFS, runner *FakeRunner, executable string) {
+				runner.Add(&FakeCommand{Stdout: "v1.26.0\n"}, executable, "--version")
+			},
+			want: "itch-setup version: <code>v1.26.0</code>",
+		},
+		{
+			name: "missing install marker",
+			setup: func(a *App, fs *MemFS, runner *FakeRunner, executable string) {
+				fs.AddError(filepath.Join(packageFolder, "versions", "1.26.0", ".installed"), os.ErrNotExist)
+			},
+			wantErr: ".installed",
+		},
+		{
+			name: "unreadable chosen version",
+			setup: func(a *App, fs *MemFS, runner *FakeRunner, executable string) {
+				fs.AddError(filepath.Join(packageFolder, ".chosen-version"), os.ErrPermission)
+			},
+			wantErr: "permission denied",
+		},
+		{
+			name: "nonzero exit",
+			setup: func(a *App, fs *MemFS, runner *FakeRunner, executable string) {
+				runner.Add(&FakeCommand{Stderr: "panic!", Err: errors.New("exit status 2")}, executable, "--version")
+			},
+			wantErr: "exit status 2",
+		},
+		{
+			name: "hang",
+			setup: func(a *App, fs *MemFS, runner *FakeRunner, executable string) {
+				a.config.Timeouts.Process = 50 * time.Millisecond
+				runner.Add(&FakeCommand{Hang: true}, executable, "--version")
+			},
+			wantErr: "Timed out",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := NewMemFS()
+			executable := addBrothPackage(fs, appDataFolder, "itch-setup", "1.26.0")
+			runner := NewFakeRunner()
+
+			a := newTestApp()
+			a.fs, a.runner = fs, runner
+			a.config.AppDataFolder = appDataFolder
+			test.setup(a, fs, runner, executable)
+
+			err := a.DiagnoseItchSetup()
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			assertEntry(t, a.report, "info", test.want)
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	loopbackRoundTrips    = 10
+	loopbackSlowThreshold = 50 * time.Millisecond
+)
+
+// DialFunc opens a connection, like net.DialTimeout
+type DialFunc func(network, address string, timeout time.Duration) (net.Conn, error)
+
+// TestLoopback opens a local TCP listener, like butlerd does, connects to it
+// and exchanges data, to make sure local connections aren't blocked.
+func (a *App) TestLoopback() error {
+	loopbackTimeout := a.config.Timeouts.Connect
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return errors.Wrap(err, "while listening")
+	}
+	defer listener.Close()
+
+	serverErrs := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			serverErrs <- errors.Wrap(err, "while accepting")
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(loopbackTimeout))
+
+		// echo everything back
+		_, err = io.Copy(conn, conn)
+		serverErrs <- err
+	}()
+
+	startTime := time.Now()
+	conn, err := a.dial("tcp", listener.Addr().String(), loopbackTimeout)
+	if err != nil {
+		return errors.Wrap(err, "while connecting")
+	}
+	defer conn.Close()
+	connectTime := time.Since(startTime)
+	conn.SetDeadline(time.Now().Add(loopbackTimeout))
+
+	payload := []byte(`{"jsonrpc":"2.0","method":"Meta.Flow","id":0}` + "\n")
+	reply := make([]byte, len(payload))
+	var total, max time.Duration
+	for i := 0; i < loopbackRoundTrips; i++ {
+		roundTripStart := time.Now()
+		_, err = conn.Write(payload)
+		if err != nil {
+			return errors.Wrap(err, "while writing")
+		}
+		_, err = io.ReadFull(conn, reply)
+		if err != nil {
+			return errors.Wrap(err, "while reading")
+		}
+		if !bytes.Equal(payload, reply) {
+			return errors.Errorf("data was altered in transit")
+		}
+
+		roundTrip := time.Since(roundTripStart)
+		total += roundTrip
+		if roundTrip > max {
+			max = roundTrip
+		}
+	}
+	conn.Close()
+
+	select {
+	case err := <-serverErrs:
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	case <-time.After(loopbackTimeout):
+		return errors.Errorf("listener did not see connection close after %s", loopbackTimeout)
+	}
+
+	average := total / loopbackRoundTrips
+	a.InfoGroup().
+		Item("Local connection on <code>%s</code>", listener.Addr().String()).
+		Item("Connect %s", formatDuration(connectTime)).
+		Item("Round-trip %s average, %s max", formatDuration(average), formatDuration(max)).
+		End()
+
+	if average > loopbackSlowThreshold || connectTime > loopbackSlowThreshold {
+		a.Warnf("Local connections are unusually slow: security software may be inspecting them, which slows down the itch app")
+	}
+
+	return nil
+}
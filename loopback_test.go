@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestLoopback(t *testing.T) {
+	a := newTestApp()
+	err := a.TestLoopback()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	assertEntry(t, a.report, "info", "Local connection on <code>127.0.0.1:")
+	assertEntry(t, a.report, "info", "Round-trip")
+}
+
+func TestLoopbackBlocked(t *testing.T) {
+	blocked := func(network, address string, timeout time.Duration) (net.Conn, error) {
+		return nil, errors.Errorf("dial %s %s: connection refused by firewall", network, address)
+	}
+
+	t.Run("loopback", func(t *testing.T) {
+		a := newTestApp()
+		a.dial = blocked
+		err := a.TestLoopback()
+		if err == nil || !strings.Contains(err.Error(), "while connecting: dial tcp 127.0.0.1:") {
+			t.Fatalf("expected a connection error, got %v", err)
+		}
+	})
+
+	t.Run("butlerd", func(t *testing.T) {
+		appDataFolder := filepath.Join(string(filepath.Separator)+"fixture", "itch")
+		fs := NewMemFS()
+		fs.AddFile(filepath.Join(appDataFolder, "db", "butler.db"), nil)
+		executable := addBrothPackage(fs, appDataFolder, "butler", "15.20.0")
+		runner := NewFakeRunner()
+
+		a := newTestApp()
+		a.fs, a.runner, a.dial = fs, runner, blocked
+		err := a.TestButlerd(appDataFolder, executable)
+		if err != nil {
+			t.Fatalf("blocked local connections should be a finding, not a butler failure: %+v", err)
+		}
+		assertEntry(t, a.report, "error", "Local connections are blocked: <code>while connecting: dial tcp 127.0.0.1:")
+		assertEntry(t, a.report, "error", "connection refused by firewall")
+		assertEntry(t, a.report, "warn", "Skipping butler daemon test")
+		if len(runner.Calls) > 0 {
+			t.Errorf("butler shouldn't run when local connections are blocked, but ran %v", runner.Calls)
+		}
+	})
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/url"
 	"os"
 	"strings"
@@ -14,19 +16,67 @@ import (
 
 // App contains all the state for itch diag
 type App struct {
-	w     webview.WebView
-	queue chan string
+	w        webview.WebView
+	queue    chan string
+	config   *Config
+	report   *Report
+	redactor *Redactor
+	// consentAsked is true once the user picked what goes in reports
+	consentAsked bool
+
+	// fs, runner and dial are how checks read files, run programs and
+	// open local connections
+	fs     FS
+	runner Runner
+	dial   DialFunc
 }
 
 const ItchDiagVersion = "0.3.0"
 
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			err := command(os.Args[2:])
+			if err != nil {
+				log.Fatalf("%+v", err)
+			}
+			return
+		}
+	}
+
+	config := DefaultConfig()
+	config.RegisterFlags(flag.CommandLine)
+	err := config.Parse(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+
+	app := &App{
+		config: config,
+		report: NewReport(),
+		fs:     osFS{},
+		runner: osRunner{},
+		dial:   net.DialTimeout,
+	}
+	if config.Redact {
+		app.redactor = NewRedactor()
+	}
+	err = app.ValidateCheckIDs()
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+
+	if config.Headless {
+		app.Diagnose()
+		return
+	}
+
 	queue := make(chan string, 20)
 	w := webview.New(webview.Settings{
 		URL:       `data:text/html,` + url.PathEscape(baseHTML),
 		Title:     fmt.Sprintf("itch diagnostics v%s", ItchDiagVersion),
-		Width:     1100,
-		Height:    800,
+		Width:     config.Window.Width,
+		Height:    config.Window.Height,
 		Resizable: true,
 		ExternalInvokeCallback: func(w webview.WebView, payload string) {
 			queue <- payload
@@ -34,10 +84,8 @@ func main() {
 	})
 	w.InjectCSS(baseCSS)
 
-	app := &App{
-		w:     w,
-		queue: queue,
-	}
+	app.w = w
+	app.queue = queue
 
 	go func() {
 		defer func() {
@@ -72,12 +120,12 @@ func (a *App) Group(level string) LogGroup {
 }
 
 func (lg *logGroup) Item(format string, args ...interface{}) LogGroup {
-	lg.items = append(lg.items, fmt.Sprintf(format, args...))
+	lg.items = append(lg.items, fmt.Sprintf(format, lg.a.redactArgs(args)...))
 	return lg
 }
 
 func (lg *logGroup) End() {
-	lg.a.Logf(lg.level, "%s", strings.Join(lg.items, " — "))
+	lg.a.logLine(lg.level, strings.Join(lg.items, " — "))
 }
 
 func (a *App) Debugf(format string, args ...interface{}) {
@@ -100,14 +148,31 @@ func (a *App) Errorf(format string, args ...interface{}) {
 	a.Logf("error", format, args...)
 }
 
+// RecordValue keeps a measurement in the report, so it can be compared
+// with other runs.
+func (a *App) RecordValue(key string, value string) {
+	a.report.SetValue(key, a.Redact(value))
+}
+
+// Logf logs a message, made of HTML markup in format, and arguments that
+// get redacted.
 func (a *App) Logf(level string, format string, args ...interface{}) {
-	line := fmt.Sprintf(format, args...)
+	a.logLine(level, fmt.Sprintf(format, a.redactArgs(args)...))
+}
+
+// logLine logs an already redacted message
+func (a *App) logLine(level string, line string) {
 	payload, err := json.Marshal(line)
 	if err != nil {
 		panic(err)
 	}
 
 	log.Print(line)
+	a.report.Add(level, line)
+	if a.w == nil {
+		return
+	}
+
 	a.w.Dispatch(func() {
 		err := a.w.Eval(`
 			(function () {
@@ -123,6 +188,13 @@ func (a *App) Logf(level string, format string, args ...interface{}) {
 	})
 }
 
+// commands are run instead of diagnostics when given as the first argument
+var commands = map[string]func(args []string) error{
+	"keygen":  RunKeygen,
+	"decrypt": RunDecrypt,
+	"compare": RunCompare,
+}
+
 // Run blocks until the webview closes
 func (a *App) Run() {
 	a.w.Run()
@@ -136,6 +208,9 @@ func (a *App) Receive(dst interface{}) {
 
 func (a *App) Must(err error) {
 	if err != nil {
+		if a.w == nil {
+			log.Fatalf("fatal error: %+v", err)
+		}
 		a.w.Dialog(
 			webview.DialogTypeAlert,
 			0,
@@ -147,6 +222,10 @@ func (a *App) Must(err error) {
 }
 
 func (a *App) Eval(code string) {
+	if a.w == nil {
+		return
+	}
+
 	a.w.Dispatch(func() {
 		err := a.w.Eval(`(function() {` + code + `})()`)
 		if err != nil {
@@ -155,16 +234,6 @@ func (a *App) Eval(code string) {
 	})
 }
 
-func (a *App) Test(label string, run func() error) {
-	a.Debugf("%s...", label)
-
-	err := run()
-	if err != nil {
-		a.Warnf("While doing '%s': <pre>%+v</pre>", label, err)
-		return
-	}
-}
-
 func (a *App) Exit() {
 	a.w.Exit()
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+// newTestApp returns a headless app that reads the actual filesystem, runs
+// actual programs and opens actual connections, until a test swaps those out.
+func newTestApp() *App {
+	return &App{
+		config: DefaultConfig(),
+		report: NewReport(),
+		fs:     osFS{},
+		runner: osRunner{},
+		dial:   net.DialTimeout,
+	}
+}
+
+// findEntry returns the first logged message at level that contains
+// substring, anywhere in the report.
+func findEntry(r *Report, level string, substring string) *ReportEntry {
+	entries := r.Entries
+	for _, check := range r.Checks {
+		entries = append(entries, check.Entries...)
+	}
+	for _, entry := range entries {
+		if entry.Level == level && strings.Contains(entry.Message, substring) {
+			return entry
+		}
+	}
+	return nil
+}
+
+func assertEntry(t *testing.T, r *Report, level string, substring string) {
+	t.Helper()
+	if findEntry(r, level, substring) == nil {
+		t.Errorf("expected a %s entry containing %q, got:\n%s", level, substring, dumpEntries(r))
+	}
+}
+
+func assertNoEntry(t *testing.T, r *Report, level string, substring string) {
+	t.Helper()
+	if entry := findEntry(r, level, substring); entry != nil {
+		t.Errorf("unexpected %s entry: %s", level, entry.Message)
+	}
+}
+
+func dumpEntries(r *Report) string {
+	var b strings.Builder
+	entries := r.Entries
+	for _, check := range r.Checks {
+		entries = append(entries, check.Entries...)
+	}
+	for _, entry := range entries {
+		b.WriteString("  [" + entry.Level + "] " + entry.Message + "\n")
+	}
+	return b.String()
+}
@@ -3,3 +3,7 @@ package main
 type UserAgentMessage struct {
 	UserAgent string
 }
+
+type ConsentMessage struct {
+	Consent []string
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MonitorConfig controls the continuous connectivity monitor mode
+type MonitorConfig struct {
+	// Duration is how long to monitor for, monitor mode is off if 0
+	Duration time.Duration
+	Interval time.Duration
+}
+
+// Outage is a period during which an endpoint kept failing
+type Outage struct {
+	Start time.Time
+	End   time.Time
+}
+
+type monitorStats struct {
+	endpoint  Endpoint
+	latencies []time.Duration
+	failures  int
+	lastError string
+	outages   []*Outage
+	current   *Outage
+}
+
+func (ms *monitorStats) samples() int {
+	return len(ms.latencies) + ms.failures
+}
+
+func (ms *monitorStats) record(t time.Time, latency time.Duration, err error) {
+	if err != nil {
+		ms.failures++
+		ms.lastError = err.Error()
+		if ms.current == nil {
+			ms.current = &Outage{Start: t}
+			ms.outages = append(ms.outages, ms.current)
+		}
+		return
+	}
+
+	ms.latencies = append(ms.latencies, latency)
+	ms.lastError = ""
+	if ms.current != nil {
+		ms.current.End = t
+		ms.current = nil
+	}
+}
+
+// percentile returns the p-th percentile (nearest rank) of latencies
+func (ms *monitorStats) percentile(p float64) time.Duration {
+	if len(ms.latencies) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), ms.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+func (ms *monitorStats) failureRate() float64 {
+	if ms.samples() == 0 {
+		return 0
+	}
+	return float64(ms.failures) / float64(ms.samples()) * 100
+}
+
+// MonitorConnectivity probes the endpoint catalog repeatedly and reports
+// latency statistics and outages, to catch intermittent problems.
+func (a *App) MonitorConnectivity() error {
+	cfg := a.config.Monitor
+	a.Infof("Monitoring %d endpoints every %s for %s...", len(a.config.Endpoints), cfg.Interval, cfg.Duration)
+
+	var stats []*monitorStats
+	for _, ep := range a.config.Endpoints {
+		stats = append(stats, &monitorStats{endpoint: ep})
+	}
+
+	deadline := time.Now().Add(cfg.Duration)
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for round := 1; ; round++ {
+		for _, ms := range stats {
+			a.monitorProbe(ms)
+		}
+		a.renderMonitorTable(stats, round)
+
+		if time.Now().Add(cfg.Interval).After(deadline) {
+			break
+		}
+		<-ticker.C
+	}
+
+	for _, ms := range stats {
+		lg := a.Group("info")
+		if ms.failures > 0 {
+			lg = a.Group("warn")
+		}
+		lg.Item("<code>%s</code>", ms.endpoint.URL).
+			Item("%d samples", ms.samples()).
+			Item("%.1f%% failed", ms.failureRate()).
+			Item("p50 %s", formatDuration(ms.percentile(50))).
+			Item("p95 %s", formatDuration(ms.percentile(95))).
+			Item("max %s", formatDuration(ms.percentile(100))).
+			End()
+
+		for _, outage := range ms.outages {
+			if outage.End.IsZero() {
+				a.Warnf("Outage since %s (ongoing)", outage.Start.Format(time.RFC3339))
+			} else {
+				a.Warnf("Outage from %s to %s (%s)", outage.Start.Format(time.RFC3339), outage.End.Format(time.RFC3339), outage.End.Sub(outage.Start).Round(time.Second))
+			}
+		}
+	}
+
+	return nil
+}
+
+func (a *App) monitorProbe(ms *monitorStats) {
+	now := time.Now()
+
+	proxyURL, err := EndpointProxy(ms.endpoint.URL)
+	if err != nil {
+		ms.record(now, 0, err)
+		return
+	}
+
+	res, err := a.ProbeEndpoint(ms.endpoint.URL, proxyURL)
+	if err != nil {
+		ms.record(now, 0, err)
+		return
+	}
+	if ms.endpoint.ExpectedStatus != 0 && res.StatusCode != ms.endpoint.ExpectedStatus {
+		ms.record(now, 0, fmt.Errorf("HTTP %d", res.StatusCode))
+		return
+	}
+	ms.record(now, res.Duration, nil)
+}
+
+func (a *App) renderMonitorTable(stats []*monitorStats, round int) {
+	var table strings.Builder
+	table.WriteString(fmt.Sprintf("<p class=\"level-debug\">Round %d (%s)</p>", round, time.Now().Format("15:04:05")))
+	table.WriteString("<table class=\"monitor\"><tr><th>Endpoint</th><th>Samples</th><th>Failed</th><th>p50</th><th>p95</th><th>max</th><th>Last error</th></tr>")
+
+	for _, ms := range stats {
+		row := []string{
+			fmt.Sprintf("<code>%s</code>", ms.endpoint.URL),
+			fmt.Sprintf("%d", ms.samples()),
+			fmt.Sprintf("%.1f%%", ms.failureRate()),
+			formatDuration(ms.percentile(50)),
+			formatDuration(ms.percentile(95)),
+			formatDuration(ms.percentile(100)),
+			html.EscapeString(excerpt(ms.lastError, 80)),
+		}
+		table.WriteString("<tr><td>" + strings.Join(row, "</td><td>") + "</td></tr>")
+
+		log.Print(a.Redact(fmt.Sprintf("[monitor #%d] %s: %d samples, %.1f%% failed, p50 %s, p95 %s, max %s %s",
+			round, ms.endpoint.URL, ms.samples(), ms.failureRate(),
+			formatDuration(ms.percentile(50)), formatDuration(ms.percentile(95)), formatDuration(ms.percentile(100)),
+			ms.lastError)))
+	}
+	table.WriteString("</table>")
+
+	payload, err := json.Marshal(a.RedactMarkup(table.String()))
+	if err != nil {
+		panic(err)
+	}
+
+	a.Eval(`
+		var monitor = document.querySelector("#monitor");
+		if (!monitor) {
+			monitor = document.createElement("div");
+			monitor.id = "monitor";
+			document.querySelector("#app").appendChild(monitor);
+		}
+		monitor.innerHTML = ` + string(payload) + `;
+	`)
+}
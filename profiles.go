@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"html"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// DiagnoseProfiles lists the itch.io accounts saved in butler.db. Display
+// names are hashed if redaction is enabled.
+func (a *App) DiagnoseProfiles() error {
+	appDataFolder, err := a.GetAppDataFolder()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	dbPath := filepath.Join(appDataFolder, "db", "butler.db")
+	err = a.EnsureFile(dbPath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	db, err := openSQLite(a.fs, dbPath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer db.Close()
+
+	profilesTable, err := db.Table("profiles")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	profiles, err := db.Rows(profilesTable)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if len(profiles) == 0 {
+		a.Infof("No saved profiles")
+		return nil
+	}
+
+	a.Infof("Found %d saved profiles", len(profiles))
+	for _, profile := range profiles {
+		profileID, _ := profile["id"].(int64)
+		lastConnected, _ := profile["last_connected"].(string)
+
+		var user struct {
+			Username    string `json:"username"`
+			DisplayName string `json:"displayName"`
+		}
+		userJSON, _ := profile["user"].(string)
+		err := json.Unmarshal([]byte(userJSON), &user)
+		if err != nil {
+			a.Warnf("Profile %d: could not read user info", profileID)
+			continue
+		}
+
+		// the username is never shown, but shouldn't leak elsewhere either
+		a.DisplayName(user.Username)
+		name := user.DisplayName
+		if name == "" {
+			name = user.Username
+		}
+		group := a.InfoGroup().
+			Item("Profile %d", profileID).
+			Item("<code>%s</code>", html.EscapeString(a.DisplayName(name)))
+		if lastConnected != "" {
+			group.Item("last connected %s", lastConnected)
+		}
+		group.End()
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// copyFixture copies a file from testdata to dst, creating folders as needed
+func copyFixture(t *testing.T, name string, dst string) {
+	t.Helper()
+	contents, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(dst, contents, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiagnoseProfiles(t *testing.T) {
+	appDataFolder, err := ioutil.TempDir("", "itch-diag-profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(appDataFolder)
+	copyFixture(t, filepath.Join("sqlite", "profiles.db"), filepath.Join(appDataFolder, "db", "butler.db"))
+
+	a := newTestApp()
+	a.config.AppDataFolder = appDataFolder
+	a.redactor = &Redactor{fired: make(map[string]int)}
+
+	a.RunCheck(Check{ID: "profiles", Label: "Listing saved profiles", Run: a.DiagnoseProfiles, Category: CategoryProfiles})
+	a.Infof("Logged in as %s", "amosw")
+
+	assertEntry(t, a.report, "info", "Found 2 saved profiles")
+	assertEntry(t, a.report, "info", "Profile 123 — <code>"+HashName("Amos Wenger")+"</code> — last connected 2026-10-01")
+	// no display name, so the username is used
+	assertEntry(t, a.report, "info", "Profile 456 — <code>"+HashName("fasterthanlime")+"</code>")
+	assertEntry(t, a.report, "info", "Logged in as "+HashName("amosw"))
+
+	dump := dumpEntries(a.report)
+	for _, leak := range []string{"Amos", "amosw", "fasterthanlime", "sekrit"} {
+		if strings.Contains(dump, leak) {
+			t.Errorf("report mentions %q:\n%s", leak, dump)
+		}
+	}
+
+	// all of it goes away if the user doesn't share profiles
+	a.report.Withhold([]string{CategoryProfiles})
+	assertNoEntry(t, a.report, "info", "saved profiles")
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/url"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// proxyEnvVars are the environment variables commonly used to configure
+// a proxy. Only some of them are honored by butler (and Go in general).
+var proxyEnvVars = []string{
+	"HTTP_PROXY",
+	"http_proxy",
+	"HTTPS_PROXY",
+	"https_proxy",
+	"NO_PROXY",
+	"no_proxy",
+	"ALL_PROXY",
+	"all_proxy",
+	"SOCKS_PROXY",
+	"socks_proxy",
+	"SOCKS5_PROXY",
+	"socks5_proxy",
+}
+
+func (a *App) DiagnoseProxy() error {
+	found := false
+	for _, name := range proxyEnvVars {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		found = true
+		a.Infof("<code>%s</code> is set to <code>%s</code>", name, displayProxy(value))
+	}
+
+	if !found {
+		a.Infof("No proxy configured in environment")
+		return nil
+	}
+
+	cfg := httpproxy.FromEnvironment()
+	if cfg.HTTPProxy == "" && cfg.HTTPSProxy == "" {
+		for _, name := range []string{"ALL_PROXY", "all_proxy", "SOCKS_PROXY", "socks_proxy", "SOCKS5_PROXY", "socks5_proxy"} {
+			if os.Getenv(name) != "" {
+				a.Warnf("<code>%s</code> is only honored by some applications: butler and the itch app will connect directly", name)
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// proxyConfig returns the proxy configuration used for connectivity probes.
+// On top of what butler honors, it falls back to ALL_PROXY and friends,
+// so we can tell whether those would work.
+func proxyConfig() *httpproxy.Config {
+	cfg := httpproxy.FromEnvironment()
+	if cfg.HTTPProxy == "" && cfg.HTTPSProxy == "" {
+		for _, name := range []string{"ALL_PROXY", "all_proxy", "SOCKS5_PROXY", "socks5_proxy", "SOCKS_PROXY", "socks_proxy"} {
+			value := os.Getenv(name)
+			if value != "" {
+				cfg.HTTPProxy = value
+				cfg.HTTPSProxy = value
+				break
+			}
+		}
+	}
+	return cfg
+}
+
+// EndpointProxy returns the proxy that would be used to reach endpoint,
+// or nil if it's reached directly.
+func EndpointProxy(endpoint string) (*url.URL, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	proxyURL, err := proxyConfig().ProxyFunc()(u)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return proxyURL, nil
+}
+
+// displayProxy hides any password contained in a proxy URL
+func displayProxy(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	if _, hasPassword := u.User.Password(); hasPassword {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/itchio/headway/united"
+	"github.com/pkg/errors"
+)
+
+// rangeReferenceSize is how much of the object we download in full,
+// to compare ranges against.
+const rangeReferenceSize = 256 * 1024
+
+var contentRangeRegexp = regexp.MustCompile(`^bytes (\d+)-(\d+)/(\d+|\*)$`)
+
+type byteRange struct {
+	start int64
+	end   int64
+}
+
+func (br byteRange) String() string {
+	return fmt.Sprintf("bytes=%d-%d", br.start, br.end)
+}
+
+// DiagnoseRanges verifies that HTTP range requests, which butler relies on to
+// resume and patch downloads, make it through the user's network intact.
+func (a *App) DiagnoseRanges() error {
+	objectURL := a.config.RangeTest.URL
+
+	proxyURL, err := EndpointProxy(objectURL)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	client := a.newDiagClient(proxyURL)
+
+	doGet := func(rangeHeader string, maxBytes int64) (*http.Response, []byte, error) {
+		req, err := http.NewRequest("GET", objectURL, nil)
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+		defer res.Body.Close()
+
+		body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxBytes))
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+		return res, body, nil
+	}
+
+	res, reference, err := doGet("", rangeReferenceSize)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if res.StatusCode != 200 {
+		return errors.Errorf("%s: HTTP %d", objectURL, res.StatusCode)
+	}
+	if res.ContentLength <= 0 {
+		a.Warnf("Server didn't send a <code>Content-Length</code>, butler will not be able to resume downloads")
+		return nil
+	}
+	if res.Header.Get("Accept-Ranges") != "bytes" {
+		a.Warnf("Server didn't announce range support (<code>Accept-Ranges: %s</code>)", res.Header.Get("Accept-Ranges"))
+	}
+	total := res.ContentLength
+	refSize := int64(len(reference))
+	if refSize == 0 {
+		return errors.Errorf("%s: got an empty body", objectURL)
+	}
+	a.Debugf("Object is %s, comparing ranges against the first %s", united.FormatBytes(total), united.FormatBytes(refSize))
+
+	ranges := []byteRange{
+		{0, min64(1023, refSize-1)},
+		{refSize / 2, min64(refSize/2+4095, refSize-1)},
+		{max64(0, refSize-1024), refSize - 1},
+	}
+
+	broken := false
+	for _, br := range ranges {
+		res, body, err := doGet(br.String(), br.end-br.start+1+1)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		problem := checkRangeResponse(res, body, br, total)
+		if problem == "" && !bytes.Equal(body, reference[br.start:br.end+1]) {
+			problem = "returned the wrong bytes"
+		}
+		if problem != "" {
+			a.Errorf("<code>Range: %s</code>: %s", br, problem)
+			broken = true
+			continue
+		}
+		a.Debugf("<code>Range: %s</code>: HTTP 206, <code>Content-Range: %s</code>", br, res.Header.Get("Content-Range"))
+	}
+
+	// suffix ranges are how butler reads the end of zip archives
+	suffixLength := min64(1024, total)
+	suffix := byteRange{total - suffixLength, total - 1}
+	suffixRes, suffixBody, err := doGet(fmt.Sprintf("bytes=-%d", suffixLength), suffixLength+1)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	problem := checkRangeResponse(suffixRes, suffixBody, suffix, total)
+	if problem == "" {
+		_, explicitBody, err := doGet(suffix.String(), suffixLength+1)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if !bytes.Equal(suffixBody, explicitBody) {
+			problem = "doesn't match the equivalent explicit range"
+		}
+	}
+	if problem != "" {
+		a.Errorf("<code>Range: bytes=-%d</code>: %s", suffixLength, problem)
+		broken = true
+	}
+
+	if broken {
+		if proxyURL != nil {
+			a.Errorf("Proxy <code>%s</code> is breaking range requests: butler won't be able to resume or patch downloads", displayProxy(proxyURL.String()))
+		} else {
+			a.Errorf("Something between you and itch.io (proxy, antivirus web shield) is breaking range requests: butler won't be able to resume or patch downloads")
+		}
+		return nil
+	}
+
+	a.Successf("Range requests work as expected")
+	return nil
+}
+
+// checkRangeResponse returns a description of what's wrong with a response
+// to a range request, or an empty string if it looks fine.
+func checkRangeResponse(res *http.Response, body []byte, br byteRange, total int64) string {
+	if res.StatusCode == 200 {
+		return "got the full body (HTTP 200) instead of a range"
+	}
+	if res.StatusCode != 206 {
+		return fmt.Sprintf("got HTTP %d instead of HTTP 206", res.StatusCode)
+	}
+
+	contentRange := res.Header.Get("Content-Range")
+	matches := contentRangeRegexp.FindStringSubmatch(contentRange)
+	if matches == nil {
+		return fmt.Sprintf("invalid or missing <code>Content-Range</code> header: <code>%s</code>", contentRange)
+	}
+	start, _ := strconv.ParseInt(matches[1], 10, 64)
+	end, _ := strconv.ParseInt(matches[2], 10, 64)
+	if start != br.start || end != br.end {
+		return fmt.Sprintf("<code>Content-Range: %s</code> doesn't match the requested range", contentRange)
+	}
+	if matches[3] != "*" && matches[3] != strconv.FormatInt(total, 10) {
+		return fmt.Sprintf("<code>Content-Range: %s</code> has the wrong total size (expected %d)", contentRange, total)
+	}
+
+	if int64(len(body)) != br.end-br.start+1 {
+		return fmt.Sprintf("got %d bytes instead of %d", len(body), br.end-br.start+1)
+	}
+	return ""
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiagnoseRanges(t *testing.T) {
+	// bigger than rangeReferenceSize, so ranges are checked against a prefix
+	content := make([]byte, rangeReferenceSize+12345)
+	rand.New(rand.NewSource(1)).Read(content)
+	total := int64(len(content))
+
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "object.bin", time.Time{}, bytes.NewReader(content))
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		level   string
+		want    string
+	}{
+		{
+			name:    "ranges honored",
+			handler: serve,
+			level:   "success",
+			want:    "Range requests work as expected",
+		},
+		{
+			name: "full body",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				r.Header.Del("Range")
+				serve(w, r)
+			},
+			level: "error",
+			want:  "got the full body (HTTP 200) instead of a range",
+		},
+		{
+			name: "wrong Content-Range",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Range") == "" {
+					serve(w, r)
+					return
+				}
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-0/%d", total))
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write(content[:1])
+			},
+			level: "error",
+			want:  "doesn't match the requested range",
+		},
+		{
+			name: "suffix range with the wrong bytes",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				rangeHeader := r.Header.Get("Range")
+				if !strings.HasPrefix(rangeHeader, "bytes=-") {
+					serve(w, r)
+					return
+				}
+				// right header, but bytes from the start of the object
+				length, _ := strconv.ParseInt(strings.TrimPrefix(rangeHeader, "bytes=-"), 10, 64)
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", total-length, total-1, total))
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write(content[:length])
+			},
+			level: "error",
+			want:  "<code>Range: bytes=-1024</code>: doesn't match the equivalent explicit range",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := httptest.NewServer(test.handler)
+			defer srv.Close()
+
+			a := newTestApp()
+			a.config.RangeTest.URL = srv.URL + "/object.bin"
+			err := a.DiagnoseRanges()
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			assertEntry(t, a.report, test.level, test.want)
+			if test.level == "error" {
+				assertEntry(t, a.report, "error", "is breaking range requests")
+			} else {
+				assertNoEntry(t, a.report, "error", "")
+			}
+		})
+	}
+}
+
+func TestCheckRangeResponse(t *testing.T) {
+	br := byteRange{100, 199}
+	tests := []struct {
+		name         string
+		status       int
+		contentRange string
+		bodySize     int
+		want         string
+	}{
+		{"valid", 206, "bytes 100-199/1000", 100, ""},
+		{"unknown total", 206, "bytes 100-199/*", 100, ""},
+		{"full body", 200, "", 1000, "got the full body"},
+		{"not satisfiable", 416, "", 0, "got HTTP 416 instead of HTTP 206"},
+		{"missing Content-Range", 206, "", 100, "invalid or missing"},
+		{"other range", 206, "bytes 0-99/1000", 100, "doesn't match the requested range"},
+		{"wrong total", 206, "bytes 100-199/999", 100, "wrong total size"},
+		{"short body", 206, "bytes 100-199/1000", 50, "got 50 bytes instead of 100"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := &http.Response{StatusCode: test.status, Header: http.Header{}}
+			if test.contentRange != "" {
+				res.Header.Set("Content-Range", test.contentRange)
+			}
+			got := checkRangeResponse(res, make([]byte, test.bodySize), br, 1000)
+			if test.want == "" {
+				if got != "" {
+					t.Errorf("expected no problem, got %q", got)
+				}
+				return
+			}
+			if !strings.Contains(got, test.want) {
+				t.Errorf("expected a problem containing %q, got %q", test.want, got)
+			}
+		})
+	}
+}
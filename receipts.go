@@ -0,0 +1,157 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// Receipt is what butler writes in `.itch/receipt.json.gz` when it
+// installs a game. We only decode the fields we report on.
+type Receipt struct {
+	Game *struct {
+		Title string `json:"title"`
+	} `json:"game"`
+	Upload *struct {
+		ID       int64  `json:"id"`
+		Filename string `json:"filename"`
+	} `json:"upload"`
+	Build *struct {
+		ID int64 `json:"id"`
+	} `json:"build"`
+	Files         []string `json:"files"`
+	InstallerName string   `json:"installerName"`
+}
+
+// DiagnoseReceipts looks for install receipts in every install location
+// known to butler.db, and in the default one.
+func (a *App) DiagnoseReceipts() error {
+	appDataFolder, err := a.GetAppDataFolder()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	locations := []string{filepath.Join(appDataFolder, "apps")}
+	locations = append(locations, a.installLocations(appDataFolder)...)
+
+	seen := make(map[string]bool)
+	for _, location := range locations {
+		if seen[location] {
+			continue
+		}
+		seen[location] = true
+
+		err := a.diagnoseInstallLocation(location)
+		if err != nil {
+			a.Warnf("While looking at <code>%s</code>: %s", location, err.Error())
+		}
+	}
+	return nil
+}
+
+// installLocations returns the install locations recorded in butler.db.
+// They're absolute paths on the user's machine, so they're ignored when
+// analyzing a snapshot.
+func (a *App) installLocations(appDataFolder string) []string {
+	if a.config.Snapshot != "" {
+		return nil
+	}
+
+	db, err := openSQLite(a.fs, filepath.Join(appDataFolder, "db", "butler.db"))
+	if err != nil {
+		return nil
+	}
+	defer db.Close()
+	table, err := db.Table("install_locations")
+	if err != nil {
+		return nil
+	}
+	rows, err := db.Rows(table)
+	if err != nil {
+		return nil
+	}
+
+	var locations []string
+	for _, row := range rows {
+		if path, ok := row["path"].(string); ok && path != "" {
+			locations = append(locations, path)
+		}
+	}
+	return locations
+}
+
+func (a *App) diagnoseInstallLocation(location string) error {
+	items, err := a.fs.ReadDir(location)
+	if err != nil {
+		if os.IsNotExist(err) {
+			a.Debugf("Install location <code>%s</code> does not exist", location)
+			return nil
+		}
+		return errors.WithStack(err)
+	}
+
+	a.Infof("Install location <code>%s</code>:", location)
+	var numValid, numMissing, numCorrupted int
+	for _, item := range items {
+		if !item.IsDir() {
+			continue
+		}
+
+		receiptPath := filepath.Join(location, item.Name(), ".itch", "receipt.json.gz")
+		receipt, err := readReceipt(a.fs, receiptPath)
+		if err != nil {
+			if os.IsNotExist(errors.Cause(err)) {
+				a.Warnf("<code>%s</code> has no receipt, the itch app won't be able to update or uninstall it", item.Name())
+				numMissing++
+				continue
+			}
+			a.Errorf("<code>%s</code> has a corrupted receipt: %s", item.Name(), err.Error())
+			numCorrupted++
+			continue
+		}
+
+		group := a.InfoGroup().Item("<code>%s</code>", item.Name())
+		if receipt.Game != nil {
+			group.Item("%s", receipt.Game.Title)
+		}
+		if receipt.Upload != nil {
+			group.Item("upload %d (<code>%s</code>)", receipt.Upload.ID, receipt.Upload.Filename)
+		}
+		if receipt.Build != nil {
+			group.Item("build %d", receipt.Build.ID)
+		}
+		if receipt.InstallerName != "" {
+			group.Item("installed with <code>%s</code>", receipt.InstallerName)
+		}
+		group.Item("%d files", len(receipt.Files))
+		group.End()
+		numValid++
+	}
+
+	a.Infof("%d valid receipts, %d missing, %d corrupted", numValid, numMissing, numCorrupted)
+	return nil
+}
+
+func readReceipt(fsys FS, path string) (*Receipt, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer gr.Close()
+
+	var receipt Receipt
+	err = json.NewDecoder(gr).Decode(&receipt)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &receipt, nil
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Redaction rule names
+const (
+	RuleSecret      = "secrets"
+	RuleDisplayName = "display names"
+	RuleKeyValue    = "credentials"
+	RuleHomeFolder  = "home folder"
+	RuleUsername    = "username"
+)
+
+// ruleOrder is the order rules are applied in: secrets and display names
+// first, so they're redacted whole even if they contain the username.
+var ruleOrder = []string{
+	RuleSecret,
+	RuleDisplayName,
+	RuleKeyValue,
+	RuleHomeFolder,
+	RuleUsername,
+}
+
+// Redactor scrubs personal information and secrets from everything
+// itch-diag logs, so that reports can be shared publicly.
+type Redactor struct {
+	mu    sync.Mutex
+	rules []*redactionRule
+	fired map[string]int
+}
+
+type redactionRule struct {
+	name    string
+	pattern *regexp.Regexp
+	replace func(match []string) string
+	// wholeWord rules only apply to matches that aren't part of a larger
+	// word, so that a user named "tim" doesn't redact "time"
+	wholeWord bool
+}
+
+// keyValueRegexp matches things like `api_key=xxx` or `"password": "xxx"`
+var keyValueRegexp = regexp.MustCompile(`(?i)("?(?:api[_-]?key|secret|token|password|authorization)"?\s*[:=]\s*"?)([^\s"',;&]+)`)
+
+func NewRedactor() *Redactor {
+	r := &Redactor{
+		fired: make(map[string]int),
+	}
+
+	homePath, _ := os.UserHomeDir()
+	if homePath != "" {
+		r.addLiteral(RuleHomeFolder, homePath, "[home]")
+		if runtime.GOOS == "windows" {
+			r.addLiteral(RuleHomeFolder, filepath.ToSlash(homePath), "[home]")
+		}
+	}
+
+	if u, err := user.Current(); err == nil {
+		username := u.Username
+		// on windows, this is DOMAIN\user
+		if i := strings.LastIndex(username, `\`); i >= 0 {
+			username = username[i+1:]
+		}
+		// short usernames would redact too much
+		if len(username) >= minRedactedWord {
+			r.add(&redactionRule{
+				name:      RuleUsername,
+				pattern:   regexp.MustCompile(`(?i)` + regexp.QuoteMeta(username)),
+				replace:   func(match []string) string { return "[user]" },
+				wholeWord: true,
+			})
+		}
+	}
+
+	r.add(&redactionRule{
+		name:    RuleKeyValue,
+		pattern: keyValueRegexp,
+		replace: func(match []string) string { return match[1] + "[redacted]" },
+	})
+
+	return r
+}
+
+func (r *Redactor) add(rule *redactionRule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rules = append(r.rules, rule)
+	sort.SliceStable(r.rules, func(i, j int) bool {
+		return ruleRank(r.rules[i].name) < ruleRank(r.rules[j].name)
+	})
+}
+
+func ruleRank(name string) int {
+	for i, candidate := range ruleOrder {
+		if candidate == name {
+			return i
+		}
+	}
+	return len(ruleOrder)
+}
+
+func (r *Redactor) addLiteral(name string, value string, replacement string) {
+	flags := ""
+	if runtime.GOOS == "windows" {
+		flags = "(?i)"
+	}
+	r.add(&redactionRule{
+		name:    name,
+		pattern: regexp.MustCompile(flags + regexp.QuoteMeta(value)),
+		replace: func(match []string) string { return replacement },
+	})
+}
+
+// minRedactedWord is how long usernames and display names must be to be
+// redacted: shorter ones would match all over the place.
+const minRedactedWord = 3
+
+// AddSecret makes sure value never shows up in anything we log
+func (r *Redactor) AddSecret(value string) {
+	if value == "" {
+		return
+	}
+	r.addLiteral(RuleSecret, value, "[secret]")
+}
+
+// AddDisplayName replaces name with a stable hash, so that several mentions
+// of the same user can still be told apart from other users.
+// Names that are too short are left alone, see DisplayName.
+func (r *Redactor) AddDisplayName(name string) {
+	name = strings.TrimSpace(name)
+	if len([]rune(name)) < minRedactedWord {
+		return
+	}
+	r.add(&redactionRule{
+		name:      RuleDisplayName,
+		pattern:   regexp.MustCompile(`(?i)` + regexp.QuoteMeta(name)),
+		replace:   func(match []string) string { return HashName(name) },
+		wholeWord: true,
+	})
+}
+
+// HashName returns a short, stable placeholder for a name
+func HashName(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return fmt.Sprintf("[user-%x]", sum[:4])
+}
+
+func (r *Redactor) Redact(s string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, rule := range r.rules {
+		s = r.apply(rule, s)
+	}
+	return s
+}
+
+func (r *Redactor) apply(rule *redactionRule, s string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range rule.pattern.FindAllStringSubmatchIndex(s, -1) {
+		start, end := loc[0], loc[1]
+		if rule.wholeWord && (endsWithWordChar(s[:start]) || startsWithWordChar(s[end:])) {
+			continue
+		}
+
+		match := make([]string, len(loc)/2)
+		for i := range match {
+			if loc[2*i] >= 0 {
+				match[i] = s[loc[2*i]:loc[2*i+1]]
+			}
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(rule.replace(match))
+		last = end
+		r.fired[rule.name]++
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+func isWordRune(c rune) bool {
+	return c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+func endsWithWordChar(s string) bool {
+	c, size := utf8.DecodeLastRuneInString(s)
+	return size > 0 && isWordRune(c)
+}
+
+func startsWithWordChar(s string) bool {
+	c, size := utf8.DecodeRuneInString(s)
+	return size > 0 && isWordRune(c)
+}
+
+// markupRegexp matches HTML tags and entities
+var markupRegexp = regexp.MustCompile(`<[^>]*>|&#?\w+;`)
+
+// RedactMarkup is like Redact, but leaves HTML tags and entities alone, so
+// that, say, a user named "code" doesn't break <code> tags.
+func (r *Redactor) RedactMarkup(s string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range markupRegexp.FindAllStringIndex(s, -1) {
+		b.WriteString(r.Redact(s[last:loc[0]]))
+		b.WriteString(s[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	b.WriteString(r.Redact(s[last:]))
+	return b.String()
+}
+
+// Fired returns how many times each rule was applied
+func (r *Redactor) Fired() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fired := make(map[string]int)
+	for name, count := range r.fired {
+		fired[name] = count
+	}
+	return fired
+}
+
+// Redact scrubs s if redaction is enabled
+func (a *App) Redact(s string) string {
+	if a.redactor == nil {
+		return s
+	}
+	return a.redactor.Redact(s)
+}
+
+// RedactMarkup scrubs the text of an HTML snippet if redaction is enabled
+func (a *App) RedactMarkup(s string) string {
+	if a.redactor == nil {
+		return s
+	}
+	return a.redactor.RedactMarkup(s)
+}
+
+// DisplayName returns how to show an itch.io display name: as a hash if
+// redaction is enabled, since short names aren't redacted everywhere.
+func (a *App) DisplayName(name string) string {
+	if a.redactor == nil {
+		return name
+	}
+	a.redactor.AddDisplayName(name)
+	return HashName(name)
+}
+
+// redactArgs wraps log arguments so they're redacted once formatted,
+// leaving the markup of the format string alone.
+func (a *App) redactArgs(args []interface{}) []interface{} {
+	if a.redactor == nil {
+		return args
+	}
+	redacted := make([]interface{}, len(args))
+	for i, arg := range args {
+		redacted[i] = redactedArg{r: a.redactor, value: arg}
+	}
+	return redacted
+}
+
+// redactedArg formats like the value it wraps, then redacts the result
+type redactedArg struct {
+	r     *Redactor
+	value interface{}
+}
+
+func (ra redactedArg) Format(f fmt.State, verb rune) {
+	io.WriteString(f, ra.r.RedactMarkup(fmt.Sprintf(formatDirective(f, verb), ra.value)))
+}
+
+// formatDirective rebuilds the directive (like "%+v") f was parsed from
+func formatDirective(f fmt.State, verb rune) string {
+	directive := "%"
+	for _, flag := range "+-# 0" {
+		if f.Flag(int(flag)) {
+			directive += string(flag)
+		}
+	}
+	if width, ok := f.Width(); ok {
+		directive += strconv.Itoa(width)
+	}
+	if precision, ok := f.Precision(); ok {
+		directive += "." + strconv.Itoa(precision)
+	}
+	return directive + string(verb)
+}
+
+// LogRedactions reports which redaction rules fired, if any
+func (a *App) LogRedactions() {
+	if a.redactor == nil {
+		a.Debugf("Redaction is disabled: this report may contain personal information")
+		return
+	}
+
+	fired := a.redactor.Fired()
+	a.report.SetRedactions(fired)
+	if len(fired) == 0 {
+		a.Debugf("Nothing needed to be redacted")
+		return
+	}
+
+	var names []string
+	for name := range fired {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var items []string
+	for _, name := range names {
+		items = append(items, fmt.Sprintf("%s (%d)", name, fired[name]))
+	}
+	a.Infof("Redacted for privacy: %s", strings.Join(items, ", "))
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// newTestRedactor returns a redactor for a user named username, whose
+// home folder is /home/username
+func newTestRedactor(username string) *Redactor {
+	r := &Redactor{
+		fired: make(map[string]int),
+	}
+	r.addLiteral(RuleHomeFolder, "/home/"+username, "[home]")
+	r.add(&redactionRule{
+		name:      RuleUsername,
+		pattern:   regexp.MustCompile(`(?i)` + regexp.QuoteMeta(username)),
+		replace:   func(match []string) string { return "[user]" },
+		wholeWord: true,
+	})
+	return r
+}
+
+func TestLogfRedactsArgsOnly(t *testing.T) {
+	a := newTestApp()
+	a.redactor = newTestRedactor("code")
+
+	a.Infof("Found <code>%s</code> (%d files), owned by %s", "/home/code/.itch", 3, "Code")
+	a.InfoGroup().Item("<code>%s</code>", "code &amp; more").Item("%5.1f%%", 12.345).End()
+
+	assertEntry(t, a.report, "info", "Found <code>[home]/.itch</code> (3 files), owned by [user]")
+	assertEntry(t, a.report, "info", "<code>[user] &amp; more</code> —  12.3%")
+}
+
+func TestAddDisplayName(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"Tim", "Tim has time", HashName("Tim") + " has time"},
+		{"Al", "Al is too short", "Al is too short"},
+		{" ", "nothing to do", "nothing to do"},
+		{"[bob]", "hi [bob]!", "hi " + HashName("[bob]") + "!"},
+		{"Zoë", "zoë and Zoëtrope", HashName("Zoë") + " and Zoëtrope"},
+		{"Tim", "Tim Tim", HashName("Tim") + " " + HashName("Tim")},
+	}
+
+	for _, test := range tests {
+		r := &Redactor{fired: make(map[string]int)}
+		r.AddDisplayName(test.name)
+		if got := r.Redact(test.input); got != test.want {
+			t.Errorf("with display name %q, Redact(%q) = %q, want %q", test.name, test.input, got, test.want)
+		}
+	}
+}
+
+func TestDisplayName(t *testing.T) {
+	a := newTestApp()
+	if got := a.DisplayName("Al"); got != "Al" {
+		t.Errorf("without redaction, expected the name itself, got %q", got)
+	}
+
+	a.redactor = &Redactor{fired: make(map[string]int)}
+	// short names aren't redacted everywhere, but never shown either
+	if got := a.DisplayName("Al"); got != HashName("Al") {
+		t.Errorf("expected a hash, got %q", got)
+	}
+	if got := a.DisplayName("Amos"); got != HashName("Amos") {
+		t.Errorf("expected a hash, got %q", got)
+	}
+	if got := a.Redact("Amos says hi"); !strings.HasPrefix(got, HashName("Amos")) {
+		t.Errorf("expected later mentions to be redacted, got %q", got)
+	}
+}
+
+func TestCheckErrorRedacted(t *testing.T) {
+	a := newTestApp()
+	a.redactor = newTestRedactor("amos")
+	// past reports aren't part of this test
+	a.config.History = false
+	a.RunCheck(Check{ID: "failing", Label: "Failing", Run: func() error {
+		return errors.Errorf("stat /home/amos/.config/itch: no such file or directory")
+	}})
+
+	if got := a.report.Checks[0].Error; got != "stat [home]/.config/itch: no such file or directory" {
+		t.Errorf("expected a redacted error, got %q", got)
+	}
+
+	sinks := make(map[string][]byte)
+	for format, write := range reportFormats {
+		var buf bytes.Buffer
+		err := write(a.report, &buf)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		sinks[format] = buf.Bytes()
+	}
+
+	var bundle bytes.Buffer
+	err := a.WriteBundle(&bundle)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(bundle.Bytes()), int64(bundle.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sinks["bundle "+f.Name] = contents
+	}
+
+	for sink, contents := range sinks {
+		if bytes.Contains(contents, []byte("amos")) {
+			t.Errorf("%s mentions the user:\n%s", sink, contents)
+		}
+	}
+}
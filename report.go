@@ -0,0 +1,348 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Check statuses
+const (
+	StatusOK      = "ok"
+	StatusWarn    = "warn"
+	StatusError   = "error"
+	StatusSkipped = "skipped"
+)
+
+// Report is everything a diagnostic run logged, organized by check
+type Report struct {
+	mu sync.Mutex
+
+	Version    string         `json:"version"`
+	OS         string         `json:"os"`
+	Arch       string         `json:"arch"`
+	StartedAt  time.Time      `json:"startedAt"`
+	FinishedAt time.Time      `json:"finishedAt"`
+	Checks     []*CheckResult `json:"checks"`
+	// Redactions counts how many times each privacy redaction rule fired
+	Redactions map[string]int `json:"redactions,omitempty"`
+	// Withheld lists the data categories the user chose not to share
+	Withheld []string `json:"withheld,omitempty"`
+	// Entries logged outside of any check
+	Entries []*ReportEntry `json:"entries"`
+
+	current *CheckResult
+}
+
+// CheckResult is the outcome of a single check
+type CheckResult struct {
+	ID       string         `json:"id"`
+	Label    string         `json:"label"`
+	Category string         `json:"category,omitempty"`
+	Status   string         `json:"status"`
+	Error    string         `json:"error,omitempty"`
+	Duration time.Duration  `json:"duration"`
+	Entries  []*ReportEntry `json:"entries"`
+	// Values are measurements worth comparing between runs, like versions
+	Values map[string]string `json:"values,omitempty"`
+
+	startedAt time.Time
+}
+
+// ReportEntry is a single logged line
+type ReportEntry struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+}
+
+func NewReport() *Report {
+	return &Report{
+		Version:   ItchDiagVersion,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		StartedAt: time.Now(),
+	}
+}
+
+func (r *Report) Add(level string, message string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry := &ReportEntry{
+		Time:    time.Now(),
+		Level:   level,
+		Message: message,
+	}
+	if r.current == nil {
+		r.Entries = append(r.Entries, entry)
+		return
+	}
+
+	r.current.Entries = append(r.current.Entries, entry)
+	switch level {
+	case "error":
+		r.current.Status = StatusError
+	case "warn":
+		if r.current.Status == StatusOK {
+			r.current.Status = StatusWarn
+		}
+	}
+}
+
+// SetValue records a measurement for the current check
+func (r *Report) SetValue(key string, value string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current == nil {
+		return
+	}
+	if r.current.Values == nil {
+		r.current.Values = make(map[string]string)
+	}
+	r.current.Values[key] = value
+}
+
+func (r *Report) BeginCheck(check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.current = &CheckResult{
+		ID:        check.ID,
+		Label:     check.Label,
+		Category:  check.Category,
+		Status:    StatusOK,
+		startedAt: time.Now(),
+	}
+	r.Checks = append(r.Checks, r.current)
+}
+
+// EndCheck finishes the current check. errText is what went wrong, if
+// anything, already redacted.
+func (r *Report) EndCheck(errText string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current == nil {
+		return
+	}
+	if errText != "" {
+		r.current.Error = errText
+		if r.current.Status == StatusOK {
+			r.current.Status = StatusWarn
+		}
+	}
+	r.current.Duration = time.Since(r.current.startedAt)
+	r.current = nil
+}
+
+func (r *Report) Skip(check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Checks = append(r.Checks, &CheckResult{
+		ID:       check.ID,
+		Label:    check.Label,
+		Category: check.Category,
+		Status:   StatusSkipped,
+	})
+}
+
+func (r *Report) SetRedactions(redactions map[string]int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Redactions = redactions
+}
+
+// Categories returns the data categories collected by checks that ran
+func (r *Report) Categories() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var categories []string
+	for _, category := range dataCategories {
+		for _, check := range r.Checks {
+			if check.Category == category.ID && check.Status != StatusSkipped {
+				categories = append(categories, category.ID)
+				break
+			}
+		}
+	}
+	return categories
+}
+
+// IsWithheld returns true if the user chose not to share category
+func (r *Report) IsWithheld(category string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return containsString(r.Withheld, category)
+}
+
+// WithheldCategories returns the data categories the user chose not to share
+func (r *Report) WithheldCategories() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.Withheld...)
+}
+
+// Withhold drops every check collecting one of the given data categories
+func (r *Report) Withhold(categories []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var kept []*CheckResult
+	for _, check := range r.Checks {
+		if containsString(categories, check.Category) {
+			continue
+		}
+		kept = append(kept, check)
+	}
+	r.Checks = kept
+	r.Withheld = append(r.Withheld, categories...)
+}
+
+func (r *Report) Finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.FinishedAt = time.Now()
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.WithStack(enc.Encode(r))
+}
+
+var htmlTagRegexp = regexp.MustCompile(`<[^>]*>`)
+
+// plainText strips the HTML markup used in log messages
+func plainText(message string) string {
+	return html.UnescapeString(htmlTagRegexp.ReplaceAllString(message, ""))
+}
+
+func (r *Report) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "itch-diag v%s (%s/%s), %s\n", r.Version, r.OS, r.Arch, r.StartedAt.Format(time.RFC3339))
+	if len(r.Withheld) > 0 {
+		fmt.Fprintf(&b, "Withheld by the user: %s\n", strings.Join(r.Withheld, ", "))
+	}
+	for _, entry := range r.Entries {
+		fmt.Fprintf(&b, "[%s] %s\n", entry.Level, plainText(entry.Message))
+	}
+	for _, check := range r.Checks {
+		fmt.Fprintf(&b, "\n== %s (%s): %s\n", check.Label, check.ID, check.Status)
+		for _, entry := range check.Entries {
+			fmt.Fprintf(&b, "[%s] %s\n", entry.Level, plainText(entry.Message))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return errors.WithStack(err)
+}
+
+func (r *Report) WriteHTML(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!doctype html><html><head><meta charset=\"UTF-8\"><title>itch diagnostics</title><style>%s</style></head><body><div id=\"app\">", baseCSS)
+	fmt.Fprintf(&b, "<p class=\"level-debug\">itch-diag v%s (%s/%s), %s</p>", r.Version, r.OS, r.Arch, r.StartedAt.Format(time.RFC3339))
+	if len(r.Withheld) > 0 {
+		fmt.Fprintf(&b, "<p class=\"level-debug\">Withheld by the user: %s</p>", html.EscapeString(strings.Join(r.Withheld, ", ")))
+	}
+	writeEntries := func(entries []*ReportEntry) {
+		for _, entry := range entries {
+			fmt.Fprintf(&b, "<p class=\"level-%s\">%s</p>", entry.Level, entry.Message)
+		}
+	}
+	writeEntries(r.Entries)
+	for _, check := range r.Checks {
+		fmt.Fprintf(&b, "<h3 class=\"status-%s\">%s <code>%s</code></h3>", check.Status, html.EscapeString(check.Label), check.Status)
+		writeEntries(check.Entries)
+	}
+	b.WriteString("</div></body></html>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return errors.WithStack(err)
+}
+
+// reportFormats are the formats reports can be written in
+var reportFormats = map[string]func(r *Report, w io.Writer) error{
+	"json": (*Report).WriteJSON,
+	"text": (*Report).WriteText,
+	"html": (*Report).WriteHTML,
+}
+
+// parseOutput splits a `format:path` output spec
+func parseOutput(spec string) (string, string, error) {
+	tokens := strings.SplitN(spec, ":", 2)
+	if len(tokens) != 2 || tokens[1] == "" {
+		return "", "", errors.Errorf("invalid output %q: should be format:path", spec)
+	}
+	format, path := tokens[0], tokens[1]
+	if _, ok := reportFormats[format]; !ok && format != "bundle" {
+		return "", "", errors.Errorf("invalid output %q: unknown format %q", spec, format)
+	}
+	return format, path, nil
+}
+
+// WriteOutputs writes the report to every output in the config
+func (a *App) WriteOutputs() {
+	for _, spec := range a.config.Outputs {
+		err := a.writeOutput(spec)
+		if err != nil {
+			a.Errorf("While writing report to <code>%s</code>: %+v", spec, err)
+			continue
+		}
+	}
+}
+
+func (a *App) writeOutput(spec string) error {
+	format, path, err := parseOutput(spec)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	write := func(w io.Writer) error {
+		return reportFormats[format](a.report, w)
+	}
+	if format == "bundle" {
+		write = a.WriteBundle
+	}
+
+	if path == "-" {
+		return write(os.Stdout)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	err = write(f)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	a.Infof("Wrote %s report to <code>%s</code>", format, path)
+	return nil
+}
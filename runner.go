@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os/exec"
+)
+
+// Runner is what checks use to run programs, so they can run against
+// scripted fakes.
+type Runner interface {
+	// Command prepares a program to run. It's killed when ctx is done.
+	Command(ctx context.Context, name string, args ...string) Process
+}
+
+// Process is the subset of *exec.Cmd checks use
+type Process interface {
+	StdoutPipe() (io.ReadCloser, error)
+	StderrPipe() (io.ReadCloser, error)
+	Start() error
+	Wait() error
+	Output() ([]byte, error)
+	CombinedOutput() ([]byte, error)
+}
+
+// osRunner runs actual programs
+type osRunner struct{}
+
+var _ Runner = osRunner{}
+
+func (osRunner) Command(ctx context.Context, name string, args ...string) Process {
+	return exec.CommandContext(ctx, name, args...)
+}
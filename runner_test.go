@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// FakeRunner replays scripted output instead of running programs
+type FakeRunner struct {
+	mu       sync.Mutex
+	commands map[string]*FakeCommand
+	// Calls records every command line that was run
+	Calls [][]string
+}
+
+// FakeCommand is how a fake program behaves
+type FakeCommand struct {
+	Stdout string
+	Stderr string
+	// Err is returned once the program "exits", e.g. an *exec.ExitError
+	Err error
+	// Hang keeps the program running (after writing its output) until
+	// it's killed.
+	Hang bool
+}
+
+var _ Runner = (*FakeRunner)(nil)
+
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{
+		commands: make(map[string]*FakeCommand),
+	}
+}
+
+// Add scripts the behavior of the program at path name. If args are
+// given, it only applies when the program is run with exactly those,
+// otherwise it applies to any arguments.
+func (fr *FakeRunner) Add(command *FakeCommand, name string, args ...string) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	fr.commands[fakeCommandKey(name, args)] = command
+}
+
+func fakeCommandKey(name string, args []string) string {
+	return strings.Join(append([]string{name}, args...), "\x00")
+}
+
+func (fr *FakeRunner) Command(ctx context.Context, name string, args ...string) Process {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	fr.Calls = append(fr.Calls, append([]string{name}, args...))
+	command, ok := fr.commands[fakeCommandKey(name, args)]
+	if !ok {
+		command, ok = fr.commands[fakeCommandKey(name, nil)]
+	}
+	if !ok {
+		command = &FakeCommand{
+			Err: errors.WithStack(&exec.Error{Name: name, Err: exec.ErrNotFound}),
+		}
+	}
+	return &fakeProcess{
+		ctx:     ctx,
+		command: command,
+	}
+}
+
+type fakeProcess struct {
+	ctx     context.Context
+	command *FakeCommand
+
+	stdout *io.PipeWriter
+	stderr *io.PipeWriter
+	done   chan error
+}
+
+func (fp *fakeProcess) StdoutPipe() (io.ReadCloser, error) {
+	r, w := io.Pipe()
+	fp.stdout = w
+	return r, nil
+}
+
+func (fp *fakeProcess) StderrPipe() (io.ReadCloser, error) {
+	r, w := io.Pipe()
+	fp.stderr = w
+	return r, nil
+}
+
+func (fp *fakeProcess) Start() error {
+	if fp.done != nil {
+		return errors.New("fake process already started")
+	}
+	if execErr, ok := errors.Cause(fp.command.Err).(*exec.Error); ok {
+		return execErr
+	}
+
+	fp.done = make(chan error, 1)
+	go func() {
+		var wg sync.WaitGroup
+		write := func(w *io.PipeWriter, s string) {
+			defer wg.Done()
+			if w == nil {
+				return
+			}
+			io.WriteString(w, s)
+		}
+		wg.Add(2)
+		go write(fp.stdout, fp.command.Stdout)
+		go write(fp.stderr, fp.command.Stderr)
+		wg.Wait()
+
+		err := fp.wait()
+		for _, w := range []*io.PipeWriter{fp.stdout, fp.stderr} {
+			if w != nil {
+				w.Close()
+			}
+		}
+		fp.done <- err
+	}()
+	return nil
+}
+
+// wait blocks until the fake program exits or is killed
+func (fp *fakeProcess) wait() error {
+	if !fp.command.Hang {
+		return fp.command.Err
+	}
+	<-fp.ctx.Done()
+	return errors.New("signal: killed")
+}
+
+func (fp *fakeProcess) Wait() error {
+	if fp.done == nil {
+		return errors.New("fake process not started")
+	}
+	return <-fp.done
+}
+
+func (fp *fakeProcess) Output() ([]byte, error) {
+	stdout, _ := fp.StdoutPipe()
+	err := fp.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	out, _ := ioutil.ReadAll(stdout)
+	err = fp.Wait()
+	return out, err
+}
+
+func (fp *fakeProcess) CombinedOutput() ([]byte, error) {
+	var out bytes.Buffer
+	stdout, _ := fp.StdoutPipe()
+	stderr, _ := fp.StderrPipe()
+	err := fp.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	collect := func(r io.Reader) {
+		defer wg.Done()
+		contents, _ := ioutil.ReadAll(r)
+		mu.Lock()
+		out.Write(contents)
+		mu.Unlock()
+	}
+	wg.Add(2)
+	go collect(stdout)
+	go collect(stderr)
+
+	err = fp.Wait()
+	wg.Wait()
+	return out.Bytes(), err
+}
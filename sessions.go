@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// APIProbeConfig controls the (opt-in) authenticated itch.io API check
+type APIProbeConfig struct {
+	Enabled bool
+	BaseURL string
+}
+
+const defaultAPIBaseURL = "https://api.itch.io"
+
+// DiagnoseSessions makes an authenticated API call with the credentials
+// stored for each profile in butler.db, to find out whether they're still
+// valid. The API key itself is never logged.
+func (a *App) DiagnoseSessions() error {
+	appDataFolder, err := a.GetAppDataFolder()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	dbPath := filepath.Join(appDataFolder, "db", "butler.db")
+	err = a.EnsureFile(dbPath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	db, err := openSQLite(a.fs, dbPath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer db.Close()
+
+	profilesTable, err := db.Table("profiles")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	profiles, err := db.Rows(profilesTable)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if len(profiles) == 0 {
+		a.Infof("No saved profiles, nothing to check")
+		return nil
+	}
+
+	for _, profile := range profiles {
+		profileID, _ := profile["id"].(int64)
+		apiKey, _ := profile["api_key"].(string)
+		if apiKey == "" {
+			a.Warnf("Profile %d has no stored credentials", profileID)
+			continue
+		}
+		if a.redactor != nil {
+			a.redactor.AddSecret(apiKey)
+		}
+
+		err := a.ProbeSession(profileID, apiKey)
+		if err != nil {
+			a.Warnf("Profile %d: could not check session: %+v", profileID, err)
+		}
+	}
+
+	return nil
+}
+
+// ProbeSession calls the profile endpoint of the itch.io API with apiKey
+// and reports whether the session is valid, expired or revoked.
+func (a *App) ProbeSession(profileID int64, apiKey string) error {
+	endpoint := strings.TrimSuffix(a.config.APIProbe.BaseURL, "/") + "/profile"
+
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	// same as butler
+	req.Header.Set("Authorization", apiKey)
+
+	proxyURL, err := EndpointProxy(endpoint)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	res, err := a.newDiagClient(proxyURL).Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxKeptBody))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var profileRes struct {
+		User *struct {
+			ID int64 `json:"id"`
+		} `json:"user"`
+		Errors []string `json:"errors"`
+	}
+	err = json.Unmarshal(body, &profileRes)
+	if err != nil {
+		return errors.Errorf("HTTP %d, not a JSON response", res.StatusCode)
+	}
+
+	apiErrors := strings.Join(profileRes.Errors, ", ")
+	switch {
+	case res.StatusCode == 200 && profileRes.User != nil:
+		a.Successf("Profile %d: session is valid (user #%d)", profileID, profileRes.User.ID)
+	case strings.Contains(strings.ToLower(apiErrors), "expired"):
+		a.Errorf("Profile %d: session has expired (<code>%s</code>), log out and log back in from the itch app", profileID, apiErrors)
+	case res.StatusCode == 401 || res.StatusCode == 403 || strings.Contains(strings.ToLower(apiErrors), "invalid key"):
+		a.Errorf("Profile %d: session was revoked (HTTP %d, <code>%s</code>), log out and log back in from the itch app", profileID, res.StatusCode, apiErrors)
+	default:
+		a.Warnf("Profile %d: unexpected API response: HTTP %d, <code>%s</code>", profileID, res.StatusCode, apiErrors)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiagnoseSessions(t *testing.T) {
+	appDataFolder, err := ioutil.TempDir("", "itch-diag-sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(appDataFolder)
+	// profile 123 has "sekrit-key", profile 456 has "other-key"
+	copyFixture(t, filepath.Join("sqlite", "profiles.db"), filepath.Join(appDataFolder, "db", "butler.db"))
+
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		level   string
+		message string
+	}{
+		{"valid", 200, `{"user": {"id": 123}}`, "success", "Profile 123: session is valid (user #123)"},
+		{"expired", 401, `{"errors": ["key expired"]}`, "error", "Profile 123: session has expired"},
+		{"revoked", 401, `{"errors": ["invalid key"]}`, "error", "Profile 123: session was revoked (HTTP 401"},
+		{"not JSON", 502, `<html>Bad Gateway</html>`, "warn", "HTTP 502, not a JSON response"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var keys []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/profile" {
+					http.NotFound(w, r)
+					return
+				}
+				keys = append(keys, r.Header.Get("Authorization"))
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.body))
+			}))
+			defer srv.Close()
+
+			a := newTestApp()
+			a.config.AppDataFolder = appDataFolder
+			a.config.APIProbe.BaseURL = srv.URL
+			a.RunCheck(Check{ID: "sessions", Label: "Checking saved itch.io sessions", Run: a.DiagnoseSessions, Category: CategoryProfiles})
+
+			if strings.Join(keys, ",") != "sekrit-key,other-key" {
+				t.Errorf("expected each profile's key to be sent, got %v", keys)
+			}
+			assertEntry(t, a.report, test.level, test.message)
+
+			var report bytes.Buffer
+			err := a.report.WriteJSON(&report)
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			for _, key := range []string{"sekrit-key", "other-key"} {
+				if strings.Contains(report.String(), key) {
+					t.Errorf("the report contains API key %q:\n%s", key, report.String())
+				}
+			}
+		})
+	}
+}
+
+func TestAPIBaseURLMustBeSecure(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		ok      bool
+	}{
+		{"https://api.itch.io", true},
+		{"http://127.0.0.1:8080", true},
+		{"http://localhost:8080", true},
+		{"http://api.itch.io", false},
+		{"http://192.168.1.10", false},
+		{"ftp://api.itch.io", false},
+	}
+
+	for _, test := range tests {
+		c := DefaultConfig()
+		c.APIProbe.BaseURL = test.baseURL
+		err := c.finish()
+		if (err == nil) != test.ok {
+			t.Errorf("with API base %q, got error %v", test.baseURL, err)
+		}
+	}
+}
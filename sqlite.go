@@ -0,0 +1,593 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// sqliteDB is a minimal, read-only reader for SQLite database files.
+// It only knows how to walk tables, which is all we need to inspect
+// butler.db without shipping a SQLite driver. Pages are read as needed,
+// and committed changes still in the write-ahead log are taken into
+// account.
+type sqliteDB struct {
+	r          io.ReaderAt
+	closer     io.Closer
+	pageSize   int
+	usableSize int
+	pageCount  int
+	// wal holds pages changed by transactions committed to the
+	// write-ahead log, which take precedence over the main file
+	wal map[int][]byte
+}
+
+// sqliteTable is an entry of the sqlite_master table
+type sqliteTable struct {
+	Name     string
+	RootPage int
+	SQL      string
+}
+
+// sqliteRow is a table row, indexed by column name
+type sqliteRow map[string]interface{}
+
+const sqliteMagic = "SQLite format 3\x00"
+
+// openSQLite opens a database file, along with its write-ahead log if any.
+// It must be closed after use.
+func openSQLite(fsys FS, path string) (*sqliteDB, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	stats, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, errors.WithStack(err)
+	}
+
+	db, err := newSQLite(f, stats.Size())
+	if err != nil {
+		f.Close()
+		return nil, errors.WithStack(err)
+	}
+	db.closer = f
+
+	walData, err := fsys.ReadFile(path + "-wal")
+	if err == nil {
+		db.applyWAL(walData)
+	}
+	return db, nil
+}
+
+func newSQLite(r io.ReaderAt, size int64) (*sqliteDB, error) {
+	header := make([]byte, 100)
+	_, err := r.ReadAt(header, 0)
+	if err != nil || string(header[:16]) != sqliteMagic {
+		return nil, errors.Errorf("not a SQLite database")
+	}
+
+	pageSize := int(binary.BigEndian.Uint16(header[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return nil, errors.Errorf("invalid SQLite page size %d", pageSize)
+	}
+	// the file format requires at least 480 usable bytes per page
+	usableSize := pageSize - int(header[20])
+	if usableSize < 480 {
+		return nil, errors.Errorf("invalid SQLite reserved space %d", header[20])
+	}
+
+	db := &sqliteDB{
+		r:          r,
+		pageSize:   pageSize,
+		usableSize: usableSize,
+		pageCount:  int(size / int64(pageSize)),
+		wal:        make(map[int][]byte),
+	}
+	return db, nil
+}
+
+func (db *sqliteDB) Close() error {
+	if db.closer == nil {
+		return nil
+	}
+	return db.closer.Close()
+}
+
+const (
+	sqliteWALHeaderSize      = 32
+	sqliteWALFrameHeaderSize = 24
+)
+
+// applyWAL reads the frames of a write-ahead log, and keeps the pages of
+// every committed transaction. Like SQLite, it stops at the first frame
+// that doesn't belong to the log (wrong salt) or is damaged (wrong
+// checksum), and ignores transactions that weren't committed.
+func (db *sqliteDB) applyWAL(data []byte) {
+	if len(data) < sqliteWALHeaderSize {
+		return
+	}
+
+	var order binary.ByteOrder
+	switch binary.BigEndian.Uint32(data[0:4]) {
+	case 0x377f0682:
+		order = binary.LittleEndian
+	case 0x377f0683:
+		order = binary.BigEndian
+	default:
+		return
+	}
+	if int(binary.BigEndian.Uint32(data[8:12])) != db.pageSize {
+		return
+	}
+
+	s0, s1 := sqliteWALChecksum(order, data[:24], 0, 0)
+	if s0 != binary.BigEndian.Uint32(data[24:28]) || s1 != binary.BigEndian.Uint32(data[28:32]) {
+		return
+	}
+	salt := data[16:24]
+
+	pending := make(map[int][]byte)
+	frameSize := sqliteWALFrameHeaderSize + db.pageSize
+	for offset := sqliteWALHeaderSize; offset+frameSize <= len(data); offset += frameSize {
+		frame := data[offset : offset+frameSize]
+		if !bytes.Equal(frame[8:16], salt) {
+			return
+		}
+		s0, s1 = sqliteWALChecksum(order, frame[:8], s0, s1)
+		s0, s1 = sqliteWALChecksum(order, frame[sqliteWALFrameHeaderSize:], s0, s1)
+		if s0 != binary.BigEndian.Uint32(frame[16:20]) || s1 != binary.BigEndian.Uint32(frame[20:24]) {
+			return
+		}
+
+		pageNumber := int(binary.BigEndian.Uint32(frame[0:4]))
+		pending[pageNumber] = frame[sqliteWALFrameHeaderSize:]
+
+		// commit frames hold the size of the database after the commit
+		if commitSize := int(binary.BigEndian.Uint32(frame[4:8])); commitSize != 0 {
+			for number, page := range pending {
+				db.wal[number] = page
+			}
+			pending = make(map[int][]byte)
+			db.pageCount = commitSize
+		}
+	}
+}
+
+// sqliteWALChecksum is the checksum used by write-ahead logs, see
+// "Checksum Algorithm" in the file format docs
+func sqliteWALChecksum(order binary.ByteOrder, b []byte, s0 uint32, s1 uint32) (uint32, uint32) {
+	for i := 0; i+8 <= len(b); i += 8 {
+		s0 += order.Uint32(b[i:]) + s1
+		s1 += order.Uint32(b[i+4:]) + s0
+	}
+	return s0, s1
+}
+
+func (db *sqliteDB) page(number int) ([]byte, error) {
+	if number < 1 || number > db.pageCount {
+		return nil, errors.Errorf("SQLite page %d out of bounds", number)
+	}
+	if page, ok := db.wal[number]; ok {
+		return page, nil
+	}
+
+	page := make([]byte, db.pageSize)
+	_, err := db.r.ReadAt(page, int64(number-1)*int64(db.pageSize))
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading SQLite page %d", number)
+	}
+	return page, nil
+}
+
+// Tables lists the tables described in sqlite_master
+func (db *sqliteDB) Tables() ([]sqliteTable, error) {
+	var tables []sqliteTable
+	err := db.walkTable(1, func(rowid int64, values []interface{}) error {
+		if len(values) < 5 {
+			return nil
+		}
+		if typ, _ := values[0].(string); typ != "table" {
+			return nil
+		}
+		name, _ := values[1].(string)
+		rootPage, _ := values[3].(int64)
+		sql, _ := values[4].(string)
+		tables = append(tables, sqliteTable{
+			Name:     name,
+			RootPage: int(rootPage),
+			SQL:      sql,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return tables, nil
+}
+
+// Table finds a table by name
+func (db *sqliteDB) Table(name string) (*sqliteTable, error) {
+	tables, err := db.Tables()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, t := range tables {
+		if t.Name == name {
+			return &t, nil
+		}
+	}
+	return nil, errors.Errorf("no table named %s", name)
+}
+
+// Rows returns all rows of a table, with columns named after
+// its CREATE TABLE statement.
+func (db *sqliteDB) Rows(t *sqliteTable) ([]sqliteRow, error) {
+	columns, rowidColumn := parseSQLiteColumns(t.SQL)
+
+	var rows []sqliteRow
+	err := db.walkTable(t.RootPage, func(rowid int64, values []interface{}) error {
+		row := make(sqliteRow)
+		for i, column := range columns {
+			if i < len(values) {
+				row[column] = values[i]
+			}
+		}
+		if rowidColumn != "" {
+			row[rowidColumn] = rowid
+		}
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return rows, nil
+}
+
+// Count returns the number of rows in a table
+func (db *sqliteDB) Count(t *sqliteTable) (int64, error) {
+	var count int64
+	err := db.walkTable(t.RootPage, func(rowid int64, values []interface{}) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return count, nil
+}
+
+// walkTable calls fn for every row of the table b-tree rooted at pageNumber
+func (db *sqliteDB) walkTable(pageNumber int, fn func(rowid int64, values []interface{}) error) error {
+	return db.walkTablePage(pageNumber, make(map[int]bool), fn)
+}
+
+func (db *sqliteDB) walkTablePage(pageNumber int, visited map[int]bool, fn func(rowid int64, values []interface{}) error) error {
+	// a corrupted b-tree could otherwise send us in circles
+	if visited[pageNumber] {
+		return errors.Errorf("page %d: referenced twice, the b-tree is corrupted", pageNumber)
+	}
+	visited[pageNumber] = true
+
+	page, err := db.page(pageNumber)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	headerOffset := 0
+	if pageNumber == 1 {
+		headerOffset = 100
+	}
+	header := page[headerOffset:]
+	pageType := header[0]
+	cellCount := int(binary.BigEndian.Uint16(header[3:5]))
+
+	headerSize := 8
+	if pageType == 0x05 {
+		headerSize = 12
+	}
+	cellsStart := headerOffset + headerSize + cellCount*2
+	if cellsStart > db.usableSize {
+		return errors.Errorf("page %d: too many cells (%d)", pageNumber, cellCount)
+	}
+	cellPointers := header[headerSize:]
+	cellOffset := func(i int) (int, error) {
+		offset := int(binary.BigEndian.Uint16(cellPointers[i*2:]))
+		if offset < cellsStart || offset >= db.usableSize {
+			return 0, errors.Errorf("page %d: cell %d is out of bounds", pageNumber, i)
+		}
+		return offset, nil
+	}
+
+	switch pageType {
+	case 0x05:
+		// interior table page
+		for i := 0; i < cellCount; i++ {
+			offset, err := cellOffset(i)
+			if err != nil {
+				return err
+			}
+			if offset+4 > db.usableSize {
+				return errors.Errorf("page %d: cell %d is out of bounds", pageNumber, i)
+			}
+			leftChild := int(binary.BigEndian.Uint32(page[offset:]))
+			err = db.walkTablePage(leftChild, visited, fn)
+			if err != nil {
+				return err
+			}
+		}
+		rightChild := int(binary.BigEndian.Uint32(header[8:12]))
+		return db.walkTablePage(rightChild, visited, fn)
+	case 0x0d:
+		// leaf table page
+		for i := 0; i < cellCount; i++ {
+			offset, err := cellOffset(i)
+			if err != nil {
+				return err
+			}
+			rowid, values, err := db.readLeafCell(page[:db.usableSize], offset)
+			if err != nil {
+				return errors.Wrapf(err, "in page %d", pageNumber)
+			}
+			err = fn(rowid, values)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return errors.Errorf("page %d: unexpected b-tree page type 0x%02x", pageNumber, pageType)
+	}
+}
+
+func (db *sqliteDB) readLeafCell(page []byte, offset int) (int64, []interface{}, error) {
+	payloadSize, n := readSQLiteVarint(page[offset:])
+	offset += n
+	rowid, n := readSQLiteVarint(page[offset:])
+	offset += n
+
+	// a payload can't be larger than the database
+	if payloadSize > uint64(db.pageCount)*uint64(db.pageSize) {
+		return 0, nil, errors.Errorf("invalid payload size %d", payloadSize)
+	}
+
+	// see "Cell Payload Overflow Pages" in the file format docs
+	u := db.usableSize
+	x := u - 35
+	p := int(payloadSize)
+	local := p
+	if p > x {
+		m := ((u-12)*32/255 - 23)
+		k := m + ((p - m) % (u - 4))
+		if k <= x {
+			local = k
+		} else {
+			local = m
+		}
+	}
+
+	if offset+local > len(page) {
+		return 0, nil, errors.Errorf("cell overflows page")
+	}
+	payload := make([]byte, 0, p)
+	payload = append(payload, page[offset:offset+local]...)
+
+	if local < p {
+		if offset+local+4 > len(page) {
+			return 0, nil, errors.Errorf("overflow page number out of bounds")
+		}
+		overflowPage := int(binary.BigEndian.Uint32(page[offset+local:]))
+		visited := make(map[int]bool)
+		for len(payload) < p {
+			if overflowPage == 0 {
+				return 0, nil, errors.Errorf("truncated overflow chain")
+			}
+			if visited[overflowPage] {
+				return 0, nil, errors.Errorf("overflow page %d referenced twice", overflowPage)
+			}
+			visited[overflowPage] = true
+
+			overflow, err := db.page(overflowPage)
+			if err != nil {
+				return 0, nil, errors.WithStack(err)
+			}
+			chunk := overflow[4:u]
+			if remaining := p - len(payload); len(chunk) > remaining {
+				chunk = chunk[:remaining]
+			}
+			payload = append(payload, chunk...)
+			overflowPage = int(binary.BigEndian.Uint32(overflow[:4]))
+		}
+	}
+
+	values, err := decodeSQLiteRecord(payload)
+	if err != nil {
+		return 0, nil, errors.WithStack(err)
+	}
+	return int64(rowid), values, nil
+}
+
+func decodeSQLiteRecord(payload []byte) ([]interface{}, error) {
+	headerSize, n := readSQLiteVarint(payload)
+	if headerSize > uint64(len(payload)) {
+		return nil, errors.Errorf("invalid record header")
+	}
+
+	var serialTypes []uint64
+	for offset := n; offset < int(headerSize); {
+		serialType, n := readSQLiteVarint(payload[offset:])
+		offset += n
+		serialTypes = append(serialTypes, serialType)
+	}
+
+	body := payload[headerSize:]
+	var values []interface{}
+	for _, serialType := range serialTypes {
+		// no value can be larger than the record
+		if serialType > 13+2*uint64(len(payload)) {
+			return nil, errors.Errorf("truncated record")
+		}
+
+		var size int
+		var value interface{}
+
+		switch {
+		case serialType == 0:
+			value = nil
+		case serialType >= 1 && serialType <= 6:
+			size = []int{0, 1, 2, 3, 4, 6, 8}[serialType]
+			if len(body) < size {
+				return nil, errors.Errorf("truncated record")
+			}
+			var v int64
+			for i := 0; i < size; i++ {
+				v = v<<8 | int64(body[i])
+			}
+			// sign-extend
+			shift := uint(64 - 8*size)
+			value = v << shift >> shift
+		case serialType == 7:
+			size = 8
+			if len(body) < size {
+				return nil, errors.Errorf("truncated record")
+			}
+			value = math.Float64frombits(binary.BigEndian.Uint64(body))
+		case serialType == 8:
+			value = int64(0)
+		case serialType == 9:
+			value = int64(1)
+		case serialType >= 12 && serialType%2 == 0:
+			size = int(serialType-12) / 2
+			if len(body) < size {
+				return nil, errors.Errorf("truncated record")
+			}
+			value = append([]byte(nil), body[:size]...)
+		case serialType >= 13:
+			size = int(serialType-13) / 2
+			if len(body) < size {
+				return nil, errors.Errorf("truncated record")
+			}
+			value = string(body[:size])
+		default:
+			return nil, errors.Errorf("unsupported serial type %d", serialType)
+		}
+
+		values = append(values, value)
+		body = body[size:]
+	}
+	return values, nil
+}
+
+func readSQLiteVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 9 && i < len(b); i++ {
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return v, len(b)
+}
+
+// parseSQLiteColumns extracts column names from a CREATE TABLE statement,
+// along with the name of the column aliasing the rowid, if any: that's an
+// INTEGER column that's the table's primary key on its own, declared either
+// on the column or as a table constraint.
+func parseSQLiteColumns(sql string) ([]string, string) {
+	start := strings.Index(sql, "(")
+	end := strings.LastIndex(sql, ")")
+	if start < 0 || end < start {
+		return nil, ""
+	}
+
+	var definitions []string
+	depth := 0
+	var current bytes.Buffer
+	for _, c := range sql[start+1 : end] {
+		switch {
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			definitions = append(definitions, current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteRune(c)
+	}
+	definitions = append(definitions, current.String())
+
+	var columns []string
+	var rowidColumn string
+	var primaryKey []string
+	isInteger := make(map[string]bool)
+	for _, definition := range definitions {
+		fields := strings.Fields(definition)
+		if len(fields) == 0 {
+			continue
+		}
+
+		upper := strings.ToUpper(definition)
+		switch strings.ToUpper(fields[0]) {
+		case "CONSTRAINT", "PRIMARY":
+			if i := strings.Index(upper, "PRIMARY KEY"); i >= 0 {
+				primaryKey = parseSQLiteKeyColumns(definition[i+len("PRIMARY KEY"):])
+			}
+			continue
+		case "UNIQUE", "CHECK", "FOREIGN":
+			continue
+		}
+
+		name := unquoteSQLiteName(fields[0])
+		columns = append(columns, name)
+
+		if len(fields) > 1 && strings.ToUpper(fields[1]) == "INTEGER" {
+			isInteger[name] = true
+			if strings.Contains(upper, "PRIMARY KEY") {
+				rowidColumn = name
+			}
+		}
+	}
+
+	if len(primaryKey) == 1 && isInteger[primaryKey[0]] {
+		rowidColumn = primaryKey[0]
+	}
+	return columns, rowidColumn
+}
+
+// parseSQLiteKeyColumns parses the "(a, b)" column list of a table constraint
+func parseSQLiteKeyColumns(s string) []string {
+	start := strings.Index(s, "(")
+	end := strings.Index(s, ")")
+	if start < 0 || end < start {
+		return nil
+	}
+
+	var columns []string
+	for _, column := range strings.Split(s[start+1:end], ",") {
+		// columns may be followed by COLLATE, ASC or DESC
+		fields := strings.Fields(column)
+		if len(fields) > 0 {
+			columns = append(columns, unquoteSQLiteName(fields[0]))
+		}
+	}
+	return columns
+}
+
+func unquoteSQLiteName(name string) string {
+	return strings.Trim(name, "\"`[]")
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func openTestSQLite(t *testing.T, name string) *sqliteDB {
+	db, err := openSQLite(osFS{}, filepath.Join("testdata", "sqlite", name))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	return db
+}
+
+func tableRows(t *testing.T, db *sqliteDB, name string) []sqliteRow {
+	table, err := db.Table(name)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	rows, err := db.Rows(table)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	return rows
+}
+
+func TestSQLiteFixture(t *testing.T) {
+	db := openTestSQLite(t, "butler.db")
+	defer db.Close()
+
+	profiles := tableRows(t, db, "profiles")
+	if len(profiles) != 200 {
+		t.Fatalf("expected 200 profiles, got %d", len(profiles))
+	}
+	// id is declared with a table-level PRIMARY KEY, so it's the rowid
+	if profiles[0]["id"] != int64(1001) || profiles[0]["api_key"] != "key-1" {
+		t.Errorf("unexpected first profile: %v", profiles[0])
+	}
+	if profiles[199]["id"] != int64(1200) || profiles[199]["user"] != "user 200" {
+		t.Errorf("unexpected last profile: %v", profiles[199])
+	}
+
+	locations := tableRows(t, db, "install_locations")
+	if len(locations) != 1 || locations[0]["id"] != "loc" || locations[0]["path"] != "/games" {
+		t.Errorf("unexpected install locations: %v", locations)
+	}
+
+	// larger than a page, so it spills into overflow pages
+	notes := tableRows(t, db, "notes")
+	if len(notes) != 1 || notes[0]["id"] != int64(7) {
+		t.Fatalf("unexpected notes: %v", notes)
+	}
+	if body, _ := notes[0]["body"].(string); body != string(bytes.Repeat([]byte("x"), 3000)) {
+		t.Errorf("overflowing note has %d bytes", len(body))
+	}
+}
+
+func profileIDs(t *testing.T, db *sqliteDB) []int64 {
+	var ids []int64
+	for _, row := range tableRows(t, db, "profiles") {
+		ids = append(ids, row["id"].(int64))
+	}
+	return ids
+}
+
+func TestSQLiteWAL(t *testing.T) {
+	db := openTestSQLite(t, "wal.db")
+	defer db.Close()
+	if ids := profileIDs(t, db); !reflect.DeepEqual(ids, []int64{1, 2, 3}) {
+		t.Errorf("with the write-ahead log, expected profiles 1, 2, 3, got %v", ids)
+	}
+
+	mainData, err := ioutil.ReadFile(filepath.Join("testdata", "sqlite", "wal.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	walData, err := ioutil.ReadFile(filepath.Join("testdata", "sqlite", "wal.db-wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		wal  []byte
+		want []int64
+	}{
+		{"no log", nil, []int64{1}},
+		// the last transaction fails its checksum
+		{"damaged last frame", corrupt(walData, len(walData)-1), []int64{1, 2}},
+		// the last transaction isn't complete
+		{"truncated log", walData[:len(walData)-100], []int64{1, 2}},
+		{"damaged header", corrupt(walData, 4), []int64{1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := newSQLite(bytes.NewReader(mainData), int64(len(mainData)))
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			db.applyWAL(test.wal)
+			if ids := profileIDs(t, db); !reflect.DeepEqual(ids, test.want) {
+				t.Errorf("expected profiles %v, got %v", test.want, ids)
+			}
+		})
+	}
+}
+
+// corrupt returns a copy of data with the byte at offset flipped
+func corrupt(data []byte, offset int) []byte {
+	data = append([]byte(nil), data...)
+	data[offset] ^= 0xff
+	return data
+}
+
+func TestSQLiteCorrupted(t *testing.T) {
+	clean, err := ioutil.ReadFile(filepath.Join("testdata", "sqlite", "butler.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := newSQLite(bytes.NewReader(clean), int64(len(clean)))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	profiles, err := db.Table("profiles")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	notes, err := db.Table("notes")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	const pageSize = 512
+	pageStart := func(number int) int { return (number - 1) * pageSize }
+	profilesRoot := pageStart(profiles.RootPage)
+	notesRoot := pageStart(notes.RootPage)
+	if clean[profilesRoot] != 0x05 || clean[notesRoot] != 0x0d {
+		t.Fatalf("fixture changed: expected profiles to span pages, and notes to fit in one")
+	}
+	// the only cell of the notes page sits at its end, and ends with
+	// the number of its first overflow page
+	if overflow := binary.BigEndian.Uint32(clean[notesRoot+pageSize-4:]); overflow == 0 || int(overflow) > len(clean)/pageSize {
+		t.Fatalf("fixture changed: expected an overflow page number, got %d", overflow)
+	}
+
+	putUint16 := func(offset int, v uint16) func([]byte) {
+		return func(data []byte) { binary.BigEndian.PutUint16(data[offset:], v) }
+	}
+	putUint32 := func(offset int, v uint32) func([]byte) {
+		return func(data []byte) { binary.BigEndian.PutUint32(data[offset:], v) }
+	}
+
+	tests := []struct {
+		name   string
+		table  *sqliteTable
+		mangle func([]byte)
+	}{
+		{"b-tree cycle", profiles, putUint32(profilesRoot+8, uint32(profiles.RootPage))},
+		{"child out of bounds", profiles, putUint32(profilesRoot+8, 0xffffffff)},
+		{"too many cells", profiles, putUint16(profilesRoot+3, 0xffff)},
+		{"cell pointer out of bounds", profiles, putUint16(profilesRoot+12, 0xfff0)},
+		{"cell pointer into header", profiles, putUint16(profilesRoot+12, 2)},
+		{"unknown page type", profiles, func(data []byte) { data[profilesRoot] = 0x42 }},
+		{"overflow page out of bounds", notes, putUint32(notesRoot+pageSize-4, 0xffffffff)},
+		{"overflow chain ends early", notes, putUint32(notesRoot+pageSize-4, 0)},
+		{"truncated file", profiles, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := append([]byte(nil), clean...)
+			if test.mangle != nil {
+				test.mangle(data)
+			} else {
+				data = data[:pageSize*3]
+			}
+
+			db, err := newSQLite(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			_, err = db.Rows(test.table)
+			if err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestParseSQLiteColumns(t *testing.T) {
+	tests := []struct {
+		sql     string
+		columns []string
+		rowid   string
+	}{
+		{"CREATE TABLE a (id integer not null primary key, name text)", []string{"id", "name"}, "id"},
+		{"CREATE TABLE a (id INTEGER, name TEXT, PRIMARY KEY (id))", []string{"id", "name"}, "id"},
+		{`CREATE TABLE "a" ("id" integer, "name" text, CONSTRAINT pk PRIMARY KEY("id" ASC))`, []string{"id", "name"}, "id"},
+		// only INTEGER primary keys alias the rowid
+		{`CREATE TABLE a ("id" text not null primary key, "path" text)`, []string{"id", "path"}, ""},
+		{"CREATE TABLE a (id int primary key, name text)", []string{"id", "name"}, ""},
+		// and only if they're the whole key
+		{"CREATE TABLE a (a integer, b integer, PRIMARY KEY (a, b))", []string{"a", "b"}, ""},
+		{"CREATE TABLE a (id integer, amount decimal(10, 2), UNIQUE (amount))", []string{"id", "amount"}, ""},
+	}
+
+	for _, test := range tests {
+		columns, rowid := parseSQLiteColumns(test.sql)
+		if !reflect.DeepEqual(columns, test.columns) || rowid != test.rowid {
+			t.Errorf("parseSQLiteColumns(%q) = %v, %q, want %v, %q", test.sql, columns, rowid, test.columns, test.rowid)
+		}
+	}
+}
+
+func TestSQLiteNoPanics(t *testing.T) {
+	clean, err := ioutil.ReadFile(filepath.Join("testdata", "sqlite", "butler.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// damaging any single byte may return garbage or errors, but must
+	// never crash
+	for offset := 0; offset < len(clean); offset++ {
+		data := corrupt(clean, offset)
+		db, err := newSQLite(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			continue
+		}
+		tables, err := db.Tables()
+		if err != nil {
+			continue
+		}
+		for _, table := range tables {
+			table := table
+			db.Rows(&table)
+		}
+	}
+}
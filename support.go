@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SupportConfig controls sending reports to itch support
+type SupportConfig struct {
+	// URL is the HTTPS endpoint reports are posted to. The action is
+	// only offered if it's set.
+	URL string
+	// Send uploads the report as soon as diagnostics are done
+	Send bool
+	// Retries is how many more times we try if an upload fails
+	Retries int
+}
+
+// SendMessage is sent by the "Send to itch support" button
+type SendMessage struct {
+	Send bool
+}
+
+// supportResponse is what the support endpoint replies with
+type supportResponse struct {
+	Reference string `json:"reference"`
+}
+
+// checkSecureURL makes sure reports and credentials only ever travel over
+// HTTPS, except to a local stand-in server. what names the URL in errors.
+func checkSecureURL(what string, value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := u.Hostname()
+		if host == "localhost" {
+			return nil
+		}
+		if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+			return nil
+		}
+	}
+	return errors.Errorf("%s must use https (got %q)", what, value)
+}
+
+// OfferSupportUpload shows a "Send to itch support" button and uploads
+// the report when it's clicked.
+func (a *App) OfferSupportUpload() {
+	a.Eval(`
+		var p = document.createElement("p");
+		var button = document.createElement("button");
+		button.id = "support-send";
+		button.innerText = "Send to itch support";
+		button.addEventListener("click", function () {
+			p.parentNode.removeChild(p);
+			window.external.invoke(JSON.stringify({
+				Send: true
+			}));
+		});
+		p.appendChild(button);
+		document.querySelector("#app").appendChild(p);
+		p.scrollIntoView();
+	`)
+	msg := &SendMessage{}
+	a.Receive(&msg)
+	if !msg.Send {
+		return
+	}
+
+	a.SendToSupport()
+}
+
+// SendToSupport uploads the report to the support endpoint, and shows the
+// reference the user should mention in their ticket.
+func (a *App) SendToSupport() {
+	a.AskConsent()
+
+	// encrypted bundles are sent whole, otherwise just the JSON report
+	var report bytes.Buffer
+	contentType := "application/json"
+	var err error
+	if a.config.Encryption.Enabled {
+		contentType = "application/octet-stream"
+		err = a.WriteBundle(&report)
+	} else {
+		err = a.report.WriteJSON(&report)
+	}
+	if err != nil {
+		a.Errorf("Could not prepare report: %+v", err)
+		return
+	}
+
+	a.Infof("Sending report to <code>%s</code>...", a.config.Support.URL)
+	reference, err := a.uploadWithRetries(report.Bytes(), contentType)
+	if err != nil {
+		a.Errorf("Could not send report to itch support: %s", err.Error())
+		a.Infof("You can still save the report with <code>-output</code> and attach it to your ticket.")
+		return
+	}
+
+	a.Successf("Report sent! Your reference is <code>%s</code>, please include it in your support ticket.", html.EscapeString(reference))
+}
+
+// uploadRetryDelay is how long we wait before retrying an upload the
+// first time, it doubles after that
+var uploadRetryDelay = time.Second
+
+func (a *App) uploadWithRetries(payload []byte, contentType string) (string, error) {
+	delay := uploadRetryDelay
+	for attempt := 0; ; attempt++ {
+		reference, retry, err := a.upload(payload, contentType)
+		if err == nil {
+			return reference, nil
+		}
+		if !retry || attempt >= a.config.Support.Retries {
+			return "", err
+		}
+
+		a.Warnf("Upload failed (%s), retrying in %s...", err.Error(), delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// upload posts payload once. retry is true if the failure looks temporary.
+func (a *App) upload(payload []byte, contentType string) (reference string, retry bool, err error) {
+	err = checkSecureURL("support URL", a.config.Support.URL)
+	if err != nil {
+		return "", false, errors.WithStack(err)
+	}
+
+	proxyURL, err := EndpointProxy(a.config.Support.URL)
+	if err != nil {
+		return "", false, errors.WithStack(err)
+	}
+
+	body := &progressReader{
+		reader:     bytes.NewReader(payload),
+		total:      int64(len(payload)),
+		onProgress: a.showUploadProgress,
+	}
+	req, err := http.NewRequest("POST", a.config.Support.URL, body)
+	if err != nil {
+		return "", false, errors.WithStack(err)
+	}
+	req.ContentLength = int64(len(payload))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", fmt.Sprintf("itch-diag/%s", ItchDiagVersion))
+
+	res, err := a.newDiagClient(proxyURL).Do(req)
+	if err != nil {
+		return "", true, errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(io.LimitReader(res.Body, maxKeptBody))
+	if err != nil {
+		return "", true, errors.WithStack(err)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		temporary := res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests
+		return "", temporary, errors.Errorf("server replied with HTTP %d: %s", res.StatusCode, excerpt(string(resBody), 200))
+	}
+
+	var response supportResponse
+	err = json.Unmarshal(resBody, &response)
+	if err != nil {
+		return "", false, errors.Wrap(err, "parsing server response")
+	}
+	if strings.TrimSpace(response.Reference) == "" {
+		return "", false, errors.Errorf("server did not return a reference")
+	}
+	return response.Reference, false, nil
+}
+
+func (a *App) showUploadProgress(sent int64, total int64) {
+	percent := 100
+	if total > 0 {
+		percent = int(sent * 100 / total)
+	}
+
+	if a.w == nil {
+		log.Printf("Uploading... %d%%", percent)
+		return
+	}
+
+	a.Eval(fmt.Sprintf(`
+		var progress = document.querySelector("#upload-progress");
+		if (!progress) {
+			progress = document.createElement("progress");
+			progress.id = "upload-progress";
+			progress.max = 100;
+			document.querySelector("#app").appendChild(progress);
+		}
+		progress.value = %d;
+		if (%d >= 100) {
+			progress.parentNode.removeChild(progress);
+		}
+	`, percent, percent))
+}
+
+// progressReader reports how much of a body was read, at most
+// once per 10%.
+type progressReader struct {
+	reader     io.Reader
+	total      int64
+	read       int64
+	reported   int64
+	onProgress func(read int64, total int64)
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.reader.Read(p)
+	pr.read += int64(n)
+	if pr.read == pr.total || (pr.read-pr.reported)*10 >= pr.total {
+		if pr.reported != pr.read {
+			pr.reported = pr.read
+			pr.onProgress(pr.read, pr.total)
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUploadWithRetries(t *testing.T) {
+	uploadRetryDelay = time.Millisecond
+	defer func() { uploadRetryDelay = time.Second }()
+
+	type reply struct {
+		status int
+		body   string
+	}
+	tests := []struct {
+		name      string
+		replies   []reply
+		url       string
+		reference string
+		wantErr   string
+		attempts  int32
+	}{
+		{
+			name:      "5xx then success",
+			replies:   []reply{{503, "busy"}, {200, `{"reference": "DIAG-1234"}`}},
+			reference: "DIAG-1234",
+			attempts:  2,
+		},
+		{
+			name:     "4xx",
+			replies:  []reply{{400, "bad report"}, {200, `{"reference": "DIAG-1234"}`}},
+			wantErr:  "HTTP 400: bad report",
+			attempts: 1,
+		},
+		{
+			name:     "no reference",
+			replies:  []reply{{200, `{}`}},
+			wantErr:  "did not return a reference",
+			attempts: 1,
+		},
+		{
+			name:     "not https",
+			url:      "http://support.example.com/reports",
+			wantErr:  "support URL must use https",
+			attempts: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&attempts, 1)
+				reply := test.replies[int(n)-1]
+				w.WriteHeader(reply.status)
+				w.Write([]byte(reply.body))
+			}))
+			defer srv.Close()
+
+			a := newTestApp()
+			a.config.Support.URL = srv.URL
+			if test.url != "" {
+				a.config.Support.URL = test.url
+			}
+			a.config.Support.Retries = 3
+
+			reference, err := a.uploadWithRetries([]byte(`{}`), "application/json")
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("expected an error containing %q, got %v", test.wantErr, err)
+				}
+			} else if err != nil {
+				t.Errorf("%+v", err)
+			}
+			if reference != test.reference {
+				t.Errorf("expected reference %q, got %q", test.reference, reference)
+			}
+			if n := atomic.LoadInt32(&attempts); n != test.attempts {
+				t.Errorf("expected %d attempts, got %d", test.attempts, n)
+			}
+		})
+	}
+}
+
+func TestSendToSupportEscapesReference(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"reference": "<img src=x onerror=alert(1)>"}`))
+	}))
+	defer srv.Close()
+
+	a := newTestApp()
+	a.config.Support.URL = srv.URL
+	a.config.History = false
+	a.SendToSupport()
+
+	assertEntry(t, a.report, "success", "<code>&lt;img src=x onerror=alert(1)&gt;</code>")
+	assertNoEntry(t, a.report, "success", "<img")
+}
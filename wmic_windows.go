@@ -1,8 +1,8 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"os/exec"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -43,7 +43,9 @@ func (a *App) RunWmic(opts WmicOptions) (WmicResult, error) {
 	}
 	args = append(args, "/format:list")
 
-	out, err := exec.Command("wmic", args...).CombinedOutput()
+	ctx, cancel := context.WithTimeout(context.Background(), a.config.Timeouts.Process)
+	defer cancel()
+	out, err := a.runner.Command(ctx, "wmic", args...).CombinedOutput()
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}